@@ -0,0 +1,410 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Anty0/tello"
+	termbox "github.com/nsf/termbox-go"
+)
+
+// Discrete drone commands issued from the keyboard or a joystick go through
+// these functions so that any safety checks apply to every input method.
+
+// takeOff reports whether the takeoff command was sent.
+func takeOff() bool {
+	if !preflightPassed() || !batteryForTakeoff() || !readyForTakeoff() {
+		return false
+	}
+	noteCommand("takeoff")
+	drone.TakeOff()
+	emitEvent("takeoff", nil)
+	applyTakeoffMode()
+	return true
+}
+
+func throwTakeOff() {
+	if !preflightPassed() || !batteryForTakeoff() || !readyForTakeoff() {
+		return
+	}
+	noteCommand("throw takeoff")
+	drone.ThrowTakeOff()
+	emitEvent("takeoff", map[string]string{"kind": "throw"})
+	applyTakeoffMode()
+}
+
+// applyTakeoffMode switches to the -takeoffmode flight mode as we take off.
+// It is part of the takeoff, so -cmdinterval does not drop it.
+func applyTakeoffMode() {
+	switch *takeoffModeFlag {
+	case "slow":
+		sendFlightMode(false)
+	case "fast":
+		if !safeLocked {
+			sendFlightMode(true)
+		}
+	}
+}
+
+func land() {
+	macros.cancel()
+	lapse.halt()
+	noteCommand("land")
+	drone.Land()
+	emitEvent("land", nil)
+}
+
+func palmLand() {
+	macros.cancel()
+	lapse.halt()
+	noteCommand("palm land")
+	drone.PalmLand()
+	emitEvent("land", map[string]string{"kind": "palm"})
+}
+
+// sendSticks sends stick positions on behalf of automatic features through the
+// joystick's stick listener. Without a joystick only the throttle can be applied,
+// via the same commands the keyboard uses.
+func sendSticks(sm tello.StickMessage) {
+	if stickChan != nil {
+		stickChan <- sm
+		recordStick(sm)
+		return
+	}
+	if sm == (tello.StickMessage{}) {
+		drone.Hover()
+		return
+	}
+	drone.Up(int(sm.Ly) * 100 / 32767)
+}
+
+// With -cmdinterval a flip, bounce, mode change or photo that follows the
+// previous one too closely is dropped rather than queued, since by the time it
+// could be sent it may no longer be wanted. Takeoffs and landings always go.
+var (
+	gateMu      sync.Mutex
+	lastCommand time.Time
+)
+
+// commandAllowed reports whether the named command may be sent now.
+func commandAllowed(name string) bool {
+	if *cmdIntervalFlag <= 0 {
+		return true
+	}
+	gateMu.Lock()
+	defer gateMu.Unlock()
+	if since := time.Since(lastCommand); since < time.Duration(*cmdIntervalFlag)*time.Millisecond {
+		log.Printf("Dropped %s, only %dms after the previous command\n", name, since.Milliseconds())
+		setAlert("Too fast - "+name+" dropped", 2*time.Second)
+		return false
+	}
+	lastCommand = time.Now()
+	return true
+}
+
+func flip(dir tello.FlipType) {
+	if safeLocked || !commandAllowed("flip") {
+		return
+	}
+	noteCommand("flip " + flipNames[dir])
+	tumble.noteFlip()
+	drone.Flip(dir)
+	countFlip()
+	rumbleEvent("flip")
+	emitEvent("flip", map[string]string{"direction": flipNames[dir]})
+	if *flipPhotoFlag > 0 {
+		scheduleFlipPhoto(time.Duration(*flipPhotoFlag) * time.Millisecond)
+	}
+}
+
+var (
+	flipPhotoMu    sync.Mutex
+	flipPhotoTimer *time.Timer
+)
+
+// scheduleFlipPhoto takes a photo after d. There is only ever one pending, a
+// flip made while waiting pushes the photo back rather than queueing another.
+func scheduleFlipPhoto(d time.Duration) {
+	flipPhotoMu.Lock()
+	defer flipPhotoMu.Unlock()
+	if flipPhotoTimer == nil {
+		flipPhotoTimer = time.AfterFunc(d, func() { takePhoto() })
+		return
+	}
+	flipPhotoTimer.Reset(d)
+}
+
+func bounce() {
+	if safeLocked || !commandAllowed("bounce") {
+		return
+	}
+	noteCommand("bounce")
+	drone.Bounce()
+}
+
+func setFastMode() {
+	if safeLocked || !commandAllowed("fast mode") {
+		return
+	}
+	sendFlightMode(true)
+}
+
+func setSlowMode() {
+	if !commandAllowed("slow mode") {
+		return
+	}
+	sendFlightMode(false)
+}
+
+func sendFlightMode(fast bool) {
+	if fast {
+		noteCommand("fast mode")
+		drone.SetFastMode()
+	} else {
+		noteCommand("slow mode")
+		drone.SetSlowMode()
+	}
+	setFlightMode(fast)
+}
+
+// The tello package has no capture mode switch of its own, so the camera mode
+// is ours and decides what the shutter (○) button does.
+const (
+	camPhoto = iota
+	camVideo
+)
+
+var cameraMode int
+
+func cycleCameraMode() {
+	if cameraMode == camPhoto {
+		cameraMode = camVideo
+	} else {
+		cameraMode = camPhoto
+	}
+}
+
+// cameraShutter takes a photo or starts/stops recording according to the camera mode.
+func cameraShutter() {
+	if cameraMode == camVideo {
+		toggleRecording()
+		return
+	}
+	takePhoto()
+}
+
+// takePhoto asks the drone for a photo, also keeping a local still with -mirrorphotos.
+// With -groundphoto block no photo is taken unless the drone is flying.
+func takePhoto() error {
+	if *groundPhotoFlag == "block" && !drone.GetFlightData().Flying {
+		setAlert("Not flying - photo blocked", 2*time.Second)
+		return errors.New("photo blocked on the ground")
+	}
+	if !commandAllowed("photo") {
+		return errors.New("photo too soon after the previous command")
+	}
+	noteCommand("photo")
+	if err := drone.TakePicture(); err != nil {
+		return err
+	}
+	countPhoto()
+	expectPic()
+	logPhoto(getStats().Photos, drone.GetFlightData())
+	if *mirrorPhotosFlag {
+		saveSnapshot()
+	}
+	return nil
+}
+
+// picsWanted is the count drone.NumPics() will reach once every photo taken
+// so far has arrived. It is set from the drone's own count at each photo, so
+// pictures that never came, or arrived from elsewhere, do not hold up exit.
+var (
+	picsMu     sync.Mutex
+	picsWanted int
+)
+
+func expectPic() {
+	picsMu.Lock()
+	defer picsMu.Unlock()
+	if n := drone.NumPics(); n > picsWanted {
+		picsWanted = n
+	}
+	picsWanted++
+}
+
+// waitForPhotos gives photos still on their way from the drone up to timeout
+// to arrive before exit, for -downloadonexit, showing progress on the status
+// line. There is no point waiting once the drone has stopped answering.
+func waitForPhotos(timeout time.Duration) {
+	picsMu.Lock()
+	wanted := picsWanted
+	picsMu.Unlock()
+	for end := time.Now().Add(timeout); ; time.Sleep(200 * time.Millisecond) {
+		got := drone.NumPics()
+		switch {
+		case got >= wanted:
+			return
+		case telemetryAge() >= linkTimeout:
+			log.Printf("Drone not answering, %d photo(s) not received\n", wanted-got)
+			return
+		case time.Now().After(end):
+			log.Printf("Gave up waiting for photos, %d not received\n", wanted-got)
+			return
+		}
+		setAlert(fmt.Sprintf("Receiving photos, %d to come - %ds", wanted-got, int(time.Until(end).Seconds())+1), time.Second)
+	}
+}
+
+// safeLocked is set by -safelock, or by the lock file existing, and disables
+// flips, bounce and fast mode and caps stick travel for lending the drone out.
+var safeLocked bool
+
+const safeLockFile = ".telloterm-safelock"
+
+func setupSafeLock() {
+	safeLocked = *safeLockFlag
+	if home, err := os.UserHomeDir(); err == nil {
+		if _, err := os.Stat(filepath.Join(home, safeLockFile)); err == nil {
+			safeLocked = true
+		}
+	}
+	if safeLocked && jsConfig.features != nil {
+		jsConfig.features = copyFeatures(jsConfig.features)
+		jsConfig.features[flipsEnabled] = false
+		jsConfig.features[faceFlipsEnabled] = false
+	}
+}
+
+// capPct limits a keyboard movement percentage while safe locked.
+func capPct(pct int) int {
+	if safeLocked && pct > *safeLockMaxFlag {
+		return *safeLockMaxFlag
+	}
+	return pct
+}
+
+// capStick limits each stick axis to -safelockmax percent of full travel while safe locked.
+func capStick(sm *tello.StickMessage) {
+	if !safeLocked {
+		return
+	}
+	max := 32767 * *safeLockMaxFlag / 100
+	for _, v := range []*int16{&sm.Lx, &sm.Ly, &sm.Rx, &sm.Ry} {
+		c := int(*v)
+		if c > max {
+			c = max
+		} else if c < -max {
+			c = -max
+		}
+		*v = int16(c)
+	}
+}
+
+type preflightItem struct {
+	name string
+	ok   bool
+}
+
+// preflightChecks evaluates the conditions required by -preflight before a takeoff.
+func preflightChecks() []preflightItem {
+	fd := drone.GetFlightData()
+	items := []preflightItem{
+		{"Battery", int(fd.BatteryPercentage) >= *preflightBattFlag},
+		{"Telemetry", telemetryAge() < time.Second},
+	}
+	if videoAge, started := videoFrameAge(); started {
+		items = append(items, preflightItem{"Video", videoAge < time.Second})
+	}
+	if *readyCheckFlag {
+		items = append(items, preflightItem{"IMU", fd.ImuState})
+	}
+	return items
+}
+
+func preflightPassed() bool {
+	if !*preflightFlag {
+		return true
+	}
+	for _, item := range preflightChecks() {
+		if !item.ok {
+			log.Printf("Takeoff refused, preflight check failed: %s\n", item.name)
+			return false
+		}
+	}
+	return true
+}
+
+// batteryForTakeoff refuses takeoff below -takeoffbatt, whether or not
+// -preflight is in use. Until telemetry arrives the battery reads zero, so
+// there is nothing to go on and takeoff is left to the drone.
+func batteryForTakeoff() bool {
+	if !telemetryStarted() {
+		return true
+	}
+	batt := int(drone.GetFlightData().BatteryPercentage)
+	if batt >= *takeoffBattFlag {
+		return true
+	}
+	log.Printf("Takeoff refused, battery at %d%%\n", batt)
+	setAlert("Battery too low to take off", 3*time.Second)
+	noteWarning("takeoff refused, battery too low")
+	return false
+}
+
+// readyForTakeoff refuses takeoff, with -readycheck, while the drone says its
+// IMU is not ready, which it does while calibrating or when sitting on a slope.
+// The drone would ignore the command anyway, this just says why.
+func readyForTakeoff() bool {
+	if !*readyCheckFlag || !telemetryStarted() || drone.GetFlightData().ImuState {
+		return true
+	}
+	log.Println("Takeoff refused, drone IMU not ready")
+	setAlert("IMU not ready - calibrating or not level?", 3*time.Second)
+	noteWarning("takeoff refused, IMU not ready")
+	return false
+}
+
+// displayPreflight shows the preflight checklist with pass/fail per item.
+func displayPreflight() {
+	x := 1
+	tbprint(x, 21, termbox.ColorWhite, termbox.ColorDefault, "Preflight:")
+	x += 11
+	for _, item := range preflightChecks() {
+		fg, mark := termbox.ColorGreen, "OK"
+		if !item.ok {
+			fg, mark = termbox.ColorRed, "NO"
+		}
+		tbprint(x, 21, termbox.ColorWhite, termbox.ColorDefault, item.name+":")
+		x += len(item.name) + 1
+		tbprint(x, 21, fg, termbox.ColorDefault, mark+"  ")
+		x += len(mark) + 2
+	}
+}
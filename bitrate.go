@@ -0,0 +1,70 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Anty0/tello"
+)
+
+// vbrNames are the -videobitrate values, in Mbit/s, and how they are shown.
+var vbrNames = map[tello.VBR]string{
+	tello.VbrAuto: "auto",
+	tello.Vbr1M:   "1",
+	tello.Vbr1M5:  "1.5",
+	tello.Vbr2M:   "2",
+	tello.Vbr3M:   "3",
+	tello.Vbr4M:   "4",
+}
+
+func parseVBR(name string) (tello.VBR, bool) {
+	for vbr, n := range vbrNames {
+		if n == name {
+			return vbr, true
+		}
+	}
+	return 0, false
+}
+
+const bitrateTimeout = 5 * time.Second
+
+// requestBitrate asks the drone for the given video bitrate and checks that it
+// took, firmware that refuses simply keeps its own setting.
+func requestBitrate(vbr tello.VBR) {
+	drone.SetVideoBitrate(vbr)
+	deadline := time.Now().Add(bitrateTimeout)
+	for time.Now().Before(deadline) {
+		drone.GetVideoBitrate()
+		time.Sleep(time.Second)
+		if drone.GetFlightData().VideoBitrate == vbr {
+			log.Printf("Video bitrate set to %s\n", vbrNames[vbr])
+			return
+		}
+	}
+	current := vbrNames[drone.GetFlightData().VideoBitrate]
+	log.Printf("Drone did not accept video bitrate %s, it is using %s\n", vbrNames[vbr], current)
+	setAlert(fmt.Sprintf("Video bitrate %s refused, using %s", vbrNames[vbr], current), 5*time.Second)
+}
@@ -0,0 +1,113 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Anty0/tello"
+)
+
+// blackBoxRecorder keeps the stick positions and commands sent to the drone
+// over the last -blackbox seconds so that, after a tumble or on a key press,
+// there is a record of exactly what the drone was told to do.
+type blackBoxRecorder struct {
+	mu      sync.Mutex
+	entries []blackBoxEntry
+}
+
+type blackBoxEntry struct {
+	t   time.Time
+	sm  tello.StickMessage
+	cmd string // empty for stick positions
+}
+
+var blackBox blackBoxRecorder
+
+func (b *blackBoxRecorder) add(e blackBoxEntry) {
+	if *blackBoxFlag <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cutoff := e.t.Add(-time.Duration(*blackBoxFlag) * time.Second)
+	i := 0
+	for i < len(b.entries) && b.entries[i].t.Before(cutoff) {
+		i++
+	}
+	b.entries = append(b.entries[i:], e)
+}
+
+// dump writes what the black box holds to a new timestamped CSV file in -mediadir.
+func (b *blackBoxRecorder) dump(reason string) {
+	if *blackBoxFlag <= 0 {
+		return
+	}
+	b.mu.Lock()
+	entries := append([]blackBoxEntry(nil), b.entries...)
+	b.mu.Unlock()
+	filename := filepath.Join(*mediaDirFlag, fmt.Sprintf("tello_blackbox_%s.csv", time.Now().Format(time.RFC3339)))
+	if err := writeBlackBox(filename, reason, entries); err != nil {
+		log.Printf("Cannot write black box - %v\n", err)
+		setAlert("Cannot write black box", 3*time.Second)
+		return
+	}
+	log.Printf("Black box (%s) written to %s\n", reason, filename)
+	setAlert("Black box saved", 3*time.Second)
+}
+
+func writeBlackBox(filename, reason string, entries []blackBoxEntry) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"Time", "Rx", "Ry", "Lx", "Ly", "Command"})
+	for _, e := range entries {
+		row := []string{e.t.Format("15:04:05.000"), "", "", "", "", e.cmd}
+		if e.cmd == "" {
+			row[1], row[2] = strconv.Itoa(int(e.sm.Rx)), strconv.Itoa(int(e.sm.Ry))
+			row[3], row[4] = strconv.Itoa(int(e.sm.Lx)), strconv.Itoa(int(e.sm.Ly))
+		}
+		w.Write(row)
+	}
+	w.Write([]string{time.Now().Format("15:04:05.000"), "", "", "", "", "dump: " + reason})
+	w.Flush()
+	return w.Error()
+}
+
+func saveBlackBox() {
+	if *blackBoxFlag <= 0 {
+		setAlert("No black box, please use -blackbox", 3*time.Second)
+		return
+	}
+	go blackBox.dump("key")
+}
@@ -0,0 +1,146 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Anty0/tello"
+	"github.com/simulatedsimian/joystick"
+)
+
+// coachState is the instructor's controller for -coachjsid. While the
+// instructor holds -coachbtn their sticks replace the student's entirely and
+// the student's buttons are ignored.
+type coachState struct {
+	mu      sync.Mutex
+	js      joystick.Joystick
+	cfg     joystickConfig
+	btn     int
+	control bool
+	sm      tello.StickMessage
+}
+
+var (
+	coach    coachState
+	useCoach bool
+)
+
+func setupCoachJoystick(id int) bool {
+	if *coachJsTypeFlag == "" {
+		badFlag("No coach joystick type supplied, please use -coachjstype")
+	}
+	btn, ok := buttonFlagNames[*coachBtnFlag]
+	if !ok {
+		badFlag("Unknown button <%s> for -coachbtn, see -joyhelp", *coachBtnFlag)
+	}
+	js, err := joystick.Open(id)
+	if err != nil {
+		badFlag("Could not open coach joystick ID:%d - %v", id, err)
+	}
+	coach.js, coach.cfg, coach.btn = js, configForType(*coachJsTypeFlag), btn
+	return true
+}
+
+// readCoachJoystick polls the instructor's controller. If it stops answering
+// the student gets control back, with a warning.
+func readCoachJoystick() {
+	var (
+		debounce buttonDebouncer
+		failing  bool
+	)
+	c := coach.cfg
+	for {
+		state, err := coach.js.Read()
+		if err == nil && len(state.AxisData) <= c.maxAxis() {
+			err = fmt.Errorf("only %d axes reported, -coachjstype %s needs %d", len(state.AxisData), *coachJsTypeFlag, c.maxAxis()+1)
+		}
+		if err != nil {
+			if !failing {
+				log.Printf("Error reading coach joystick: %v\n", err)
+			}
+			failing = true
+			if coach.set(false, tello.StickMessage{}) {
+				setAlert("Coach joystick lost - student has control", 10*time.Second)
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+		failing = false
+		state.Buttons = debounce.filter(state.Buttons, time.Now())
+
+		var sm tello.StickMessage
+		sm.Rx = c.stick(state, axLeftX, c.axes[axLeftX], false)
+		sm.Ry = c.stick(state, axLeftY, c.axes[axLeftY], true)
+		sm.Lx = c.stick(state, axRightX, c.axes[axRightX], false)
+		sm.Ly = c.stick(state, axRightY, c.axes[axRightY], true)
+		for _, v := range []*int16{&sm.Rx, &sm.Ry, &sm.Lx, &sm.Ly} {
+			if intAbs(*v) < deadZone {
+				*v = 0
+			}
+		}
+		coach.set(c.held(state, coach.btn), sm)
+		time.Sleep(updatePeriodMs * time.Millisecond)
+	}
+}
+
+// set records the instructor's sticks and whether they have control, and
+// reports whether control was handed back to the student.
+func (c *coachState) set(control bool, sm tello.StickMessage) bool {
+	c.mu.Lock()
+	changed := control != c.control
+	c.control, c.sm = control, sm
+	c.mu.Unlock()
+	if !changed {
+		return false
+	}
+	if control {
+		log.Println("Instructor has control")
+		noteCommand("instructor control")
+		// whatever the student started is the instructor's to undo
+		drone.CancelAutoFlyToXY()
+		macros.cancel()
+		return false
+	}
+	log.Println("Student has control")
+	noteCommand("student control")
+	return true
+}
+
+// sticks returns the instructor's sticks if they have control.
+func (c *coachState) sticks() (tello.StickMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sm, c.control
+}
+
+// status is the status line text showing who is flying.
+func (c *coachState) status() string {
+	if _, control := c.sticks(); control {
+		return "INSTRUCTOR"
+	}
+	return "STUDENT"
+}
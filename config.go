@@ -0,0 +1,351 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// appConfig holds the settings read from the JSON configuration file.
+type appConfig struct {
+	// Keys maps single character keys to keyboard action names, see keyActions.
+	Keys map[string]string `json:"keys,omitempty"`
+	// DpadFlips maps the D-Pad directions up, down, left and right to flip names, see flipNames.
+	DpadFlips map[string]string `json:"dpad_flips,omitempty"`
+	// Devices maps joystick names, as shown by -jslist, to the profile used when that joystick is plugged in.
+	Devices map[string]deviceProfile `json:"devices,omitempty"`
+	// Options sets command line options, by name without the dash, unless they are given on the command line.
+	Options map[string]string `json:"options,omitempty"`
+	// Rumble replaces the -rumble pattern for an event, see rumblePatterns.
+	Rumble map[string][]rumbleStep `json:"rumble,omitempty"`
+}
+
+// deviceProfile holds joystick settings picked by device name. Options given
+// on the command line take precedence.
+type deviceProfile struct {
+	JsType       string                  `json:"jstype"`
+	FaceFlips    bool                    `json:"faceflips,omitempty"`
+	LeftHanded   bool                    `json:"lefthanded,omitempty"`
+	ThrottleAxis *int                    `json:"throttleaxis,omitempty"`
+	YawAxis      *int                    `json:"yawaxis,omitempty"`
+	UnsignedAxes bool                    `json:"unsignedaxes,omitempty"`
+	AxisScale    string                  `json:"axisscale,omitempty"`
+	EndAxes      string                  `json:"endaxes,omitempty"`
+	DpadFlips    map[string]string       `json:"dpad_flips,omitempty"`
+	Rumble       map[string][]rumbleStep `json:"rumble,omitempty"`
+}
+
+var config appConfig
+
+// configDir is where telloterm keeps its configuration and other saved state.
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "telloterm"), nil
+}
+
+// profileFor returns the profile for the named joystick. An exact name match
+// wins, otherwise the first (alphabetically) name contained in it is used.
+func profileFor(name string) (deviceProfile, string, bool) {
+	if p, ok := config.Devices[name]; ok {
+		return p, name, true
+	}
+	names := make([]string, 0, len(config.Devices))
+	for n := range config.Devices {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if n != "" && strings.Contains(strings.ToLower(name), strings.ToLower(n)) {
+			return config.Devices[n], n, true
+		}
+	}
+	return deviceProfile{}, "", false
+}
+
+// applyProfile copies p's settings into the flags not set on the command line.
+func applyProfile(p deviceProfile) {
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if !given["jstype"] && p.JsType != "" {
+		*jsTypeFlag = p.JsType
+	}
+	if !given["faceflips"] && p.FaceFlips {
+		*faceFlipsFlag = true
+	}
+	if !given["lefthanded"] && p.LeftHanded {
+		*leftHandedFlag = true
+	}
+	if !given["unsignedaxes"] && p.UnsignedAxes {
+		*unsignedAxesFlag = true
+	}
+	if !given["axisscale"] && p.AxisScale != "" {
+		*axisScaleFlag = p.AxisScale
+	}
+	if !given["endaxes"] && p.EndAxes != "" {
+		*endAxesFlag = p.EndAxes
+	}
+	if !given["throttleaxis"] && p.ThrottleAxis != nil {
+		*throttleAxisFlag = *p.ThrottleAxis
+	}
+	if !given["yawaxis"] && p.YawAxis != nil {
+		*yawAxisFlag = *p.YawAxis
+	}
+	if len(p.DpadFlips) > 0 {
+		flips := map[string]string{}
+		for d, f := range p.DpadFlips {
+			flips[d] = f
+		}
+		for d, f := range config.DpadFlips {
+			flips[d] = f
+		}
+		config.DpadFlips = flips
+	}
+}
+
+// loadConfig reads the -config file, or config.json in configDir if that exists.
+func loadConfig(filename string) error {
+	if filename == "" {
+		dir, err := configDir()
+		if err != nil {
+			return nil
+		}
+		filename = filepath.Join(dir, "config.json")
+		if _, err := os.Stat(filename); err != nil {
+			return nil
+		}
+	}
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(buf, &config); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	return nil
+}
+
+// sessionOptions only make sense for one run, so they are neither exported
+// nor accepted in the configuration file.
+var sessionOptions = map[string]bool{
+	"config": true, "exportconfig": true, "importconfig": true, "cpuprofile": true,
+	"logfile": true, "jslist": true, "jstest": true, "jsvalidate": true, "jsdrift": true,
+	"joyhelp": true, "keyhelp": true, "dronelist": true, "simdrone": true,
+	"fdlog": true, "rawlog": true, "statsfile": true,
+}
+
+// applyOptions sets the configuration file's options, except those given on
+// the command line. Values are checked with everything else afterwards.
+func applyOptions(opts map[string]string) error {
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for name, value := range opts {
+		if flag.Lookup(name) == nil || sessionOptions[name] {
+			return fmt.Errorf("unknown option <%s>", name)
+		}
+		if given[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("option %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// exportConfig writes the active configuration, the file's settings and the
+// value of every option, to filename for -exportconfig.
+func exportConfig(filename string) error {
+	c := config
+	c.Options = map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) {
+		if !sessionOptions[f.Name] {
+			c.Options[f.Name] = f.Value.String()
+		}
+	})
+	buf, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(buf, '\n'), 0644)
+}
+
+// importConfig checks an exported configuration for -importconfig and, if it
+// is good, makes it the default configuration. Any previous one is kept as
+// config.json.bak.
+func importConfig(filename string) error {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	var c appConfig
+	if err = dec.Decode(&c); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	if err = applyKeyConfig(c.Keys); err != nil {
+		return err
+	}
+	if err = applyFlipConfig(c.DpadFlips); err != nil {
+		return err
+	}
+	for name, p := range c.Devices {
+		if err = applyFlipConfig(p.DpadFlips); err != nil {
+			return fmt.Errorf("device %s: %v", name, err)
+		}
+		if p.AxisScale != "" {
+			if _, err = parseAxisScale(p.AxisScale); err != nil {
+				return fmt.Errorf("device %s: %v", name, err)
+			}
+		}
+		if p.EndAxes != "" {
+			if _, err = parseEndAxes(p.EndAxes); err != nil {
+				return fmt.Errorf("device %s: %v", name, err)
+			}
+		}
+	}
+	if err = applyOptions(c.Options); err != nil {
+		return err
+	}
+	if err = checkOptions(); err != nil {
+		return err
+	}
+
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	dest := filepath.Join(dir, "config.json")
+	if _, err := os.Stat(dest); err == nil {
+		if err = os.Rename(dest, dest+".bak"); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(dest, buf, 0644)
+}
+
+// checkOptions rejects option values that parse but make no sense, whether
+// they came from the command line or a configuration. The checks that need a
+// joystick or the drone are made when those are set up.
+func checkOptions() error {
+	if *unitsFlag != "metric" && *unitsFlag != "imperial" {
+		return fmt.Errorf("Unknown -units <%s>, options are metric or imperial", *unitsFlag)
+	}
+	if net.ParseIP(*droneIPFlag) == nil {
+		return fmt.Errorf("-droneip <%s> is not a valid IP address", *droneIPFlag)
+	}
+	if *dronePortFlag < 1 || *dronePortFlag > 65535 {
+		return fmt.Errorf("-droneport %d is not a valid UDP port", *dronePortFlag)
+	}
+	if *startupDelayFlag < 0 {
+		return errors.New("-startupdelay cannot be negative")
+	}
+	if _, ok := parseVBR(*videoBitrateFlag); !ok && *videoBitrateFlag != "" {
+		return fmt.Errorf("-videobitrate <%s> must be auto, 1, 1.5, 2, 3 or 4", *videoBitrateFlag)
+	}
+	if *onOverheatFlag != "" && *onOverheatFlag != "warn" && *onOverheatFlag != "land" {
+		return fmt.Errorf("Unknown -onoverheat <%s>, options are warn or land", *onOverheatFlag)
+	}
+	if *simDroneFlag && *rawLogFlag != "" {
+		return errors.New("-rawlog cannot be used with -simdrone")
+	}
+	if *takeoffModeFlag != "slow" && *takeoffModeFlag != "fast" && *takeoffModeFlag != "default" {
+		return errors.New("-takeoffmode must be slow, fast or default")
+	}
+	if *groundPhotoFlag != "allow" && *groundPhotoFlag != "block" {
+		return errors.New("-groundphoto must be allow or block")
+	}
+	if *recordSegmentFlag < 0 {
+		return errors.New("-recordsegment must not be negative")
+	}
+	if *recordSlewFlag < 0 {
+		return errors.New("-recordslew must not be negative")
+	}
+	if *landOnJsLossFlag < 0 {
+		return errors.New("-landonjsloss must not be negative")
+	}
+	if _, ok := videoFlips[*videoFlipFlag]; !ok {
+		return errors.New("-videoflip must be none, horizontal, vertical or 180")
+	}
+	if *smoothTelemetryFlag < 0 || *smoothTelemetryFlag >= 1 {
+		return errors.New("-smoothtelemetry must be at least 0 and less than 1")
+	}
+	if *droneRateFlag < 0 || *droneRateFlag > 1000 {
+		return errors.New("-dronerate must be between 0 and 1000")
+	}
+	if fi, err := os.Stat(*mediaDirFlag); err != nil || !fi.IsDir() {
+		return fmt.Errorf("-mediadir <%s> is not a directory", *mediaDirFlag)
+	}
+	if *centerEaseFlag < 0 || *centerEaseFlag >= 1 {
+		return errors.New("-centerease must be at least 0 and less than 1")
+	}
+	if *dropProtectFlag && (*dropRateFlag <= 0 || *dropBoostFlag <= 0) {
+		return errors.New("-droprate and -dropboost must be more than 0 with -dropprotect")
+	}
+	if *safeLockMaxFlag < 0 || *safeLockMaxFlag > 100 {
+		return errors.New("-safelockmax must be between 0 and 100")
+	}
+	for name, pct := range map[string]int{
+		"orbitspeed": *orbitSpeedFlag, "orbityaw": *orbitYawFlag, "selfiespeed": *selfieSpeedFlag,
+		"panoramayaw": *panoramaYawFlag, "climbspeed": *climbSpeedFlag,
+	} {
+		if pct < 0 || pct > 100 {
+			return fmt.Errorf("-%s must be between 0 and 100", name)
+		}
+	}
+	if *axisScaleFlag != "" {
+		if _, err := parseAxisScale(*axisScaleFlag); err != nil {
+			return fmt.Errorf("Bad -axisscale - %v", err)
+		}
+	}
+	if *endAxesFlag != "" {
+		if _, err := parseEndAxes(*endAxesFlag); err != nil {
+			return fmt.Errorf("Bad -endaxes - %v", err)
+		}
+	}
+	if _, ok := tuneParams[*tuneParamFlag]; !ok {
+		return fmt.Errorf("Unknown -tuneparam <%s>, options are max, expo and yaw", *tuneParamFlag)
+	}
+	switch *jsVerifyFlag {
+	case "off", "new", "always":
+	default:
+		return fmt.Errorf("Unknown -jsverify <%s>, options are off, new or always", *jsVerifyFlag)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// Tello EDUs joined to an ordinary WiFi network (station mode) get their
+// addresses from DHCP. We find them by sending the SDK "command" request to
+// every address on our local /24 networks and noting which answer "ok".
+
+const discoverTimeout = 2 * time.Second
+
+// discoverDrones returns the addresses of the Tellos that answer, in order.
+func discoverDrones(port int) ([]string, error) {
+	hosts, err := localHosts()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	for _, h := range hosts {
+		conn.WriteToUDP([]byte("command"), &net.UDPAddr{IP: h, Port: port})
+	}
+
+	found := map[string]bool{}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(discoverTimeout))
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break // the deadline has passed
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(buf[:n]), []byte("ok")) {
+			found[from.IP.String()] = true
+		}
+	}
+	drones := make([]string, 0, len(found))
+	for ip := range found {
+		drones = append(drones, ip)
+	}
+	sort.Slice(drones, func(i, j int) bool {
+		return bytes.Compare(net.ParseIP(drones[i]), net.ParseIP(drones[j])) < 0
+	})
+	return drones, nil
+}
+
+// localHosts lists the other addresses in the /24 around each of our IPv4
+// addresses, larger networks would take too long to probe.
+func localHosts() ([]net.IP, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	var hosts []net.IP
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() {
+			continue
+		}
+		ip := ipnet.IP.To4()
+		if ip == nil {
+			continue
+		}
+		for i := 1; i < 255; i++ {
+			h := net.IPv4(ip[0], ip[1], ip[2], byte(i))
+			if !h.Equal(ip) {
+				hosts = append(hosts, h)
+			}
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no IPv4 network found")
+	}
+	return hosts, nil
+}
+
+// listDrones prints the discovered drones for -dronelist.
+func listDrones() {
+	drones, err := discoverDrones(*dronePortFlag)
+	if err != nil {
+		fmt.Printf("Cannot look for drones - %v\n", err)
+		return
+	}
+	if len(drones) == 0 {
+		fmt.Println("No drones found")
+		return
+	}
+	for i, ip := range drones {
+		fmt.Printf("Drone index: %d: IP: %s\n", i, ip)
+	}
+}
+
+// selectDrone points -droneip at the -droneindex'th discovered drone.
+func selectDrone(index int) {
+	drones, err := discoverDrones(*dronePortFlag)
+	if err != nil {
+		badFlag("Cannot look for drones for -droneindex - %v", err)
+	}
+	if index >= len(drones) {
+		badFlag("-droneindex %d but only %d drone(s) found, see -dronelist", index, len(drones))
+	}
+	*droneIPFlag = drones[index]
+}
@@ -0,0 +1,78 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"time"
+
+	"github.com/Anty0/tello"
+)
+
+// droneController is the part of tello.Tello that telloterm uses, so that
+// -simdrone can stand in for a real drone.
+type droneController interface {
+	ControlConnect(udpAddr string, droneUDPPort int, localUDPPort int) error
+	ControlDisconnect()
+	VideoConnect(udpAddr string, droneUDPPort int) (<-chan []byte, error)
+	VideoDisconnect()
+	GetFlightData() tello.FlightData
+	StreamFlightData(asAsync bool, periodMs time.Duration) (<-chan tello.FlightData, error)
+	StartStickListener() (chan<- tello.StickMessage, error)
+
+	TakeOff()
+	ThrowTakeOff()
+	Land()
+	PalmLand()
+	Bounce()
+	Hover()
+	Flip(dir tello.FlipType)
+	SetFastMode()
+	SetSlowMode()
+	Forward(pct int)
+	Backward(pct int)
+	Left(pct int)
+	Right(pct int)
+	Up(pct int)
+	Down(pct int)
+	TurnLeft(pct int)
+	TurnRight(pct int)
+	StartSmartVideo(cmd tello.SVCmd) error
+	SetHome() error
+	IsHomeSet() bool
+	AutoFlyToXY(x, y float32) (<-chan bool, error)
+	CancelAutoFlyToXY()
+
+	TakePicture() error
+	NumPics() int
+	SaveAllPics(prefix string) (int, error)
+
+	GetLowBatteryThreshold()
+	GetMaxHeight()
+	GetSSID()
+	GetVersion()
+	GetVideoBitrate()
+	SetVideoBitrate(vbr tello.VBR)
+	GetVideoSpsPps()
+	SetVideoNormal()
+	SetVideoWide()
+}
@@ -0,0 +1,130 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Anty0/tello"
+)
+
+// Event is one line of the -eventjson output.
+type Event struct {
+	Time    time.Time   `json:"time"`
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+var (
+	eventMu  sync.Mutex
+	eventOut io.WriteCloser
+	eventEnc *json.Encoder
+)
+
+// setupEvents opens the -eventjson destination: "-" for stdout (the display
+// uses the terminal directly), tcp://host:port or udp://host:port for a
+// socket, otherwise a file.
+func setupEvents(dest string) error {
+	var err error
+	switch {
+	case dest == "-":
+		eventOut = os.Stdout
+	case strings.HasPrefix(dest, "tcp://"), strings.HasPrefix(dest, "udp://"):
+		eventOut, err = net.Dial(dest[:3], dest[6:])
+	default:
+		eventOut, err = os.Create(dest)
+	}
+	if err != nil {
+		return err
+	}
+	eventEnc = json.NewEncoder(eventOut)
+	go watchConnection()
+	return nil
+}
+
+func closeEvents() {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	if eventOut != nil && eventOut != os.Stdout {
+		eventOut.Close()
+	}
+	eventEnc = nil
+}
+
+// emitEvent writes an event as a line of JSON, if -eventjson is in use.
+func emitEvent(typ string, payload interface{}) {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	if eventEnc == nil {
+		return
+	}
+	if err := eventEnc.Encode(Event{time.Now(), typ, payload}); err != nil {
+		log.Printf("Error writing event - %v\n", err)
+	}
+}
+
+var flipNames = map[tello.FlipType]string{
+	tello.FlipForward: "forward", tello.FlipBackward: "backward", tello.FlipLeft: "left", tello.FlipRight: "right",
+	tello.FlipForwardLeft: "forward_left", tello.FlipForwardRight: "forward_right",
+	tello.FlipBackwardLeft: "backward_left", tello.FlipBackwardRight: "backward_right",
+}
+
+var lastBattLow, lastBattCrit bool
+
+// noteFlightData emits events for changes in the flight data worth reporting.
+func noteFlightData(fd tello.FlightData) {
+	if fd.BatteryLow != lastBattLow || fd.BatteryCritical != lastBattCrit {
+		if fd.BatteryCritical {
+			noteWarning("drone battery critical")
+		} else if fd.BatteryLow {
+			noteWarning("drone battery low")
+		}
+		if fd.BatteryLow || fd.BatteryCritical {
+			rumbleEvent("battery")
+			emitEvent("battery_warning", map[string]interface{}{
+				"percent": fd.BatteryPercentage, "low": fd.BatteryLow, "critical": fd.BatteryCritical,
+			})
+		}
+		lastBattLow, lastBattCrit = fd.BatteryLow, fd.BatteryCritical
+	}
+}
+
+// watchConnection emits connection_state whenever telemetry starts or stops arriving.
+func watchConnection() {
+	connected := false
+	for {
+		now := telemetryAge() < time.Second
+		if now != connected {
+			emitEvent("connection_state", map[string]bool{"connected": now})
+			connected = now
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
@@ -0,0 +1,106 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Anty0/tello"
+)
+
+// flightLogger writes some of the flight data to a CSV file, either for the
+// whole session with -fdlog or between presses of -fdlogbtn.
+type flightLogger struct {
+	mu       sync.Mutex
+	file     *os.File
+	w        *csv.Writer
+	filename string
+}
+
+var fdLogger flightLogger
+
+func (l *flightLogger) open(filename string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"Time", "X", "Y", "Z", "Yaw", "FDHeight"}); err != nil {
+		f.Close()
+		return err
+	}
+	l.file, l.w, l.filename = f, w, filename
+	return nil
+}
+
+func (l *flightLogger) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	l.w.Flush()
+	l.file.Close()
+	l.file, l.w = nil, nil
+}
+
+func (l *flightLogger) write(fd tello.FlightData) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.w == nil {
+		return
+	}
+	l.w.Write([]string{time.Now().Format("15:04:05.000"), fmt.Sprintf("%f", fd.MVO.PositionX),
+		fmt.Sprintf("%f", fd.MVO.PositionY), fmt.Sprintf("%f", fd.MVO.PositionZ),
+		fmt.Sprintf("%d", fd.IMU.Yaw), fmt.Sprintf("%.1f", float32(fd.Height)/10)})
+}
+
+func (l *flightLogger) active() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file != nil
+}
+
+// toggle stops logging, or starts it in a new timestamped file in -mediadir.
+func (l *flightLogger) toggle() {
+	if l.active() {
+		l.close()
+		log.Println("Flight data logging stopped")
+		return
+	}
+	filename := filepath.Join(*mediaDirFlag, fmt.Sprintf("tello_fd_%s.csv", time.Now().Format(time.RFC3339)))
+	if err := l.open(filename); err != nil {
+		log.Printf("Cannot start flight data log - %v\n", err)
+		setAlert("Cannot start flight data log", 3*time.Second)
+		return
+	}
+	log.Printf("Flight data logging to %s\n", filename)
+}
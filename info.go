@@ -0,0 +1,68 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// droneInfo identifies the connected drone. The tello package does not report
+// a serial number, so the SSID and firmware version are the best we have. They
+// are shown with the other fields on row 22 and saved by -recordsidecar.
+type droneInfo struct {
+	SSID    string
+	Version string
+}
+
+const infoTimeout = 5 * time.Second
+
+var (
+	infoMu      sync.Mutex
+	info        droneInfo
+	infoFetched bool // true once fetching has finished, whether or not it succeeded
+)
+
+// fetchDroneInfo asks the drone for its identity until it answers or infoTimeout passes.
+func fetchDroneInfo() {
+	deadline := time.Now().Add(infoTimeout)
+	for {
+		fd := drone.GetFlightData()
+		if fd.SSID != "" && fd.Version != "" || time.Now().After(deadline) {
+			infoMu.Lock()
+			info = droneInfo{SSID: fd.SSID, Version: fd.Version}
+			infoFetched = true
+			infoMu.Unlock()
+			return
+		}
+		drone.GetSSID()
+		drone.GetVersion()
+		time.Sleep(time.Second)
+	}
+}
+
+func getDroneInfo() (droneInfo, bool) {
+	infoMu.Lock()
+	defer infoMu.Unlock()
+	return info, infoFetched
+}
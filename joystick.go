@@ -23,9 +23,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"math"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Anty0/tello"
@@ -33,9 +37,11 @@ import (
 )
 
 var (
-	js       joystick.Joystick
-	jsConfig joystickConfig
-	err      error
+	js          joystick.Joystick
+	jsConfig    joystickConfig
+	camJs       joystick.Joystick
+	camJsConfig joystickConfig
+	err         error
 )
 
 // Sticks
@@ -48,6 +54,8 @@ const (
 	axL2
 	axR1
 	axR2
+	axThrottle // optional separate throttle lever, see -throttleaxis
+	axYaw      // optional twist axis for turning, see -yawaxis
 )
 
 // Buttons
@@ -72,29 +80,384 @@ const (
 	btnUnknown
 )
 
+var axisNames = []string{
+	axLeftX: "Left Stick X", axLeftY: "Left Stick Y", axRightX: "Right Stick X", axRightY: "Right Stick Y",
+	axL1: "L1", axL2: "L2", axR1: "R1", axR2: "R2", axThrottle: "Throttle", axYaw: "Yaw",
+}
+
+var buttonNames = []string{
+	btnX: "╳", btnCircle: "○", btnTriangle: "△", btnSquare: "⌑",
+	btnL1: "L1", btnL2: "L2", btnL3: "L3", btnR1: "R1", btnR2: "R2", btnR3: "R3",
+	btnDL: "D-Pad Left", btnDR: "D-Pad Right", btnDU: "D-Pad Up", btnDD: "D-Pad Down",
+	btnHome: "Home", btnSelect: "Select", btnStart: "Start", btnUnknown: "Unknown",
+}
+
+// buttonFlagNames are the names used to choose a button in options such as -orbitbtn.
+var buttonFlagNames = map[string]int{
+	"x": btnX, "circle": btnCircle, "triangle": btnTriangle, "square": btnSquare,
+	"l1": btnL1, "l2": btnL2, "l3": btnL3, "r1": btnR1, "r2": btnR2, "r3": btnR3,
+	"dleft": btnDL, "dright": btnDR, "dup": btnDU, "ddown": btnDD,
+	"home": btnHome, "select": btnSelect, "start": btnStart,
+}
+
+// buttonAction is an optional feature bound to a button chosen on the command line.
+type buttonAction struct {
+	btn     int
+	name    string
+	action  func()
+	release func() // optional, for actions that last while the button is held
+}
+
+var boundActions []buttonAction
+
+// bindButton binds action to the button named by the option, an empty name leaves it unbound.
+func bindButton(option, btnName, name string, action func()) {
+	if btnName == "" {
+		return
+	}
+	btn, ok := buttonFlagNames[btnName]
+	if !ok {
+		badFlag("Unknown button <%s> for -%s, see -joyhelp", btnName, option)
+	}
+	boundActions = append(boundActions, buttonAction{btn, name, action, nil})
+}
+
+// bindHoldButton is bindButton for an action that stops when the button is let go.
+func bindHoldButton(option, btnName, name string, action, release func()) {
+	bindButton(option, btnName, name, action)
+	if btnName != "" {
+		boundActions[len(boundActions)-1].release = release
+	}
+}
+
+// recordWhileHeld starts recording for -holdrecord, unless already recording.
+func recordWhileHeld() {
+	if isRecording() {
+		return
+	}
+	if err := startRecording(); err != nil {
+		log.Printf("Unable to start ffmpeg - %v\n", err)
+	}
+}
+
+func setupBindings() {
+	setupHoldActions()
+	bindButton("camtoggle", *camToggleFlag, "camera mode", cycleCameraMode)
+	bindButton("climbbtn", *climbBtnFlag, "takeoff and climb", func() { macros.start("climb", takeoffToHeight(*climbHeightFlag)) })
+	bindButton("fdlogbtn", *fdLogBtnFlag, "flight data log", fdLogger.toggle)
+	bindButton("figure8btn", *figure8BtnFlag, "figure-8", func() { macros.start("figure-8", figure8Macro) })
+	if btn, ok := buttonFlagNames[*headingBtnFlag]; ok {
+		holdActions[btn] = holdAction{"set heading", setHeading}
+	}
+	bindButton("headingbtn", *headingBtnFlag, "turn to heading", toHeading)
+	bindHoldButton("holdrecord", *holdRecordFlag, "record while held", recordWhileHeld, stopRecording)
+	bindButton("invertbtn", *invertBtnFlag, "invert", toggleInverted)
+	bindButton("orbitbtn", *orbitBtnFlag, "orbit", func() { macros.start("orbit", orbitMacro) })
+	bindButton("panoramabtn", *panoramaBtnFlag, "panorama", func() { macros.start("panorama", panoramaMacro) })
+	bindButton("selfiebtn", *selfieBtnFlag, "selfie", func() { macros.start("selfie", selfieMacro) })
+	bindButton("zeroyawbtn", *zeroYawBtnFlag, "zero heading", zeroYaw)
+}
+
+// flipButton is a button that flips the drone in the given direction.
+type flipButton struct {
+	btn int
+	dir tello.FlipType
+}
+
+var dpadFlipButtons = []flipButton{
+	{btnDU, tello.FlipForward},
+	{btnDD, tello.FlipBackward},
+	{btnDL, tello.FlipLeft},
+	{btnDR, tello.FlipRight},
+}
+
+// faceFlipButtons are the flips performed with R2 held when -faceflips is used.
+var faceFlipButtons = []flipButton{
+	{btnTriangle, tello.FlipForward},
+	{btnX, tello.FlipBackward},
+	{btnSquare, tello.FlipLeft},
+	{btnCircle, tello.FlipRight},
+}
+
 // Features
 const (
 	flipsEnabled = iota
 	homeEnabled
+	faceFlipsEnabled // hold R2 and press a face button to flip, for pads without a D-pad
+	unsignedAxes     // axes read 0 to 65535 with the centre at 32768, see -unsignedaxes
+	liveTuning       // tuneAxis adjusts -tuneparam while flying
 )
 
 const deadZone = 2000
 
+// squareDeadZone zeroes each axis of a stick on its own when it is within the
+// dead zone, leaving the travel outside it unchanged.
+func squareDeadZone(x, y *int16) {
+	if intAbs(*x) < deadZone {
+		*x = 0
+	}
+	if intAbs(*y) < deadZone {
+		*y = 0
+	}
+}
+
+// radialDeadZone applies the dead zone to the distance of a stick from centre
+// rather than to each axis, so diagonals near the centre behave like straight
+// moves. Outside it the travel is rescaled to start from zero at its edge.
+func radialDeadZone(x, y *int16) {
+	mag := math.Hypot(float64(*x), float64(*y))
+	if mag < deadZone {
+		*x, *y = 0, 0
+		return
+	}
+	scale := (mag - deadZone) / (32767 - deadZone) * 32767 / mag
+	*x = clampAxis(float64(*x) * scale)
+	*y = clampAxis(float64(*y) * scale)
+}
+
+func clampAxis(v float64) int16 {
+	if v > 32767 {
+		return 32767
+	} else if v < -32767 {
+		return -32767
+	}
+	return int16(math.Round(v))
+}
+
+// joystickConfig maps our logical axes and buttons onto device indices,
+// buttons left out of the map are simply not available on that controller.
 type joystickConfig struct {
 	axes     []int
-	buttons  []uint
-	features []bool
+	buttons  map[int]uint
+	features map[int]bool
+	scale    []float64   // per logical axis multipliers, see -axisscale, missing ones are 1
+	ends     map[int]int // logical axes that rest at an end, 1 for the low end and -1 the high, see -endaxes
+	tuneAxis int         // device axis of a dial for -tuneparam, with the liveTuning feature
+}
+
+// held reports whether the given logical button is down, unmapped buttons never are.
+func (c joystickConfig) held(state joystick.State, btn int) bool {
+	ix, ok := c.buttons[btn]
+	return ok && state.Buttons&(1<<ix) != 0
+}
+
+// throttleAxis returns the device axis for a separate throttle control, if there is one.
+func (c joystickConfig) throttleAxis() (int, bool) {
+	return c.optionalAxis(axThrottle)
+}
+
+// optionalAxis returns the device axis for a logical axis that the config
+// may leave out, those from axThrottle on, which are -1 when unused.
+func (c joystickConfig) optionalAxis(ax int) (int, bool) {
+	if len(c.axes) <= ax || c.axes[ax] < 0 {
+		return 0, false
+	}
+	return c.axes[ax], true
+}
+
+// withAxis returns axes with the optional logical axis ax on device axis ix.
+func withAxis(axes []int, ax, ix int) []int {
+	with := make([]int, len(axes))
+	copy(with, axes)
+	for len(with) <= ax {
+		with = append(with, -1)
+	}
+	with[ax] = ix
+	return with
+}
+
+// axisValue converts a raw axis reading to a stick value. Signed axes should
+// read -32767 to 32767 but some drivers give 32768 at one end, which is kept
+// in range rather than wrapping round to the other end. Unsigned axes are
+// shifted down to centre on zero first.
+func (c joystickConfig) axisValue(raw int) int16 {
+	if c.features[unsignedAxes] {
+		raw -= 32768
+	}
+	if raw > 32767 {
+		return 32767
+	} else if raw < -32767 {
+		return -32767
+	}
+	return int16(raw)
+}
+
+// axisScale returns the multiplier for a logical axis.
+func (c joystickConfig) axisScale(ax int) float64 {
+	if ax < len(c.scale) && c.scale[ax] != 0 {
+		return c.scale[ax]
+	}
+	return 1
+}
+
+// stick reads logical axis ax from device axis ix. Axes resting at an end
+// read 0 there and 32767 at full travel, others are centred on 0 and, with
+// flip, negated so that pushing a Y axis away gives a positive value.
+func (c joystickConfig) stick(state joystick.State, ax, ix int, flip bool) int16 {
+	v := c.axisValue(state.AxisData[ix])
+	if sign, ok := c.ends[ax]; ok {
+		return int16((int(v)*sign + 32767) / 2)
+	}
+	if flip {
+		return -v
+	}
+	return v
+}
+
+// parseEndAxes reads -endaxes, axis names separated by commas, each
+// optionally followed by =low (the default) or =high for the end it rests at.
+func parseEndAxes(spec string) (map[int]int, error) {
+	ends := map[int]int{}
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		ax, ok := axisScaleNames[parts[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown axis <%s>, options are leftx, lefty, rightx, righty, throttle and yaw", parts[0])
+		}
+		ends[ax] = 1
+		if len(parts) == 2 {
+			switch parts[1] {
+			case "low":
+			case "high":
+				ends[ax] = -1
+			default:
+				return nil, fmt.Errorf("end <%s> for %s should be low or high", parts[1], parts[0])
+			}
+		}
+	}
+	return ends, nil
+}
+
+// axisScaleNames are the axes that -axisscale can scale.
+var axisScaleNames = map[string]int{
+	"leftx": axLeftX, "lefty": axLeftY, "rightx": axRightX, "righty": axRightY, "throttle": axThrottle, "yaw": axYaw,
+}
+
+// parseAxisScale reads -axisscale, either one factor for every axis or
+// axis=factor pairs separated by commas.
+func parseAxisScale(spec string) ([]float64, error) {
+	scale := make([]float64, axYaw+1)
+	if f, err := strconv.ParseFloat(spec, 64); err == nil {
+		if f <= 0 {
+			return nil, fmt.Errorf("factor %s must be positive", spec)
+		}
+		for i := range scale {
+			scale[i] = f
+		}
+		return scale, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("entry <%s> should be axis=factor", pair)
+		}
+		ax, ok := axisScaleNames[parts[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown axis <%s>, options are leftx, lefty, rightx, righty, throttle and yaw", parts[0])
+		}
+		f, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || f <= 0 {
+			return nil, fmt.Errorf("factor <%s> for %s must be a positive number", parts[1], parts[0])
+		}
+		scale[ax] = f
+	}
+	return scale, nil
+}
+
+// maxAxis is the highest device axis index the config uses.
+func (c joystickConfig) maxAxis() int {
+	max := 0
+	for _, ix := range c.axes {
+		if ix > max {
+			max = ix
+		}
+	}
+	if c.features[liveTuning] && c.tuneAxis > max {
+		max = c.tuneAxis
+	}
+	return max
+}
+
+func (c joystickConfig) hasButtons(btns ...int) bool {
+	for _, btn := range btns {
+		if _, ok := c.buttons[btn]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// pressed reports a rising edge of the given logical button between two reads.
+func (c joystickConfig) pressed(state, prev joystick.State, btn int) bool {
+	return c.held(state, btn) && !c.held(prev, btn)
+}
+
+// groundPress is what the takeoff and land buttons ask for in one read.
+type groundPress struct {
+	takeOff      bool   // △
+	throwTakeOff bool   // ⌑ on the ground
+	palmLand     bool   // ⌑ in the air
+	land         bool   // ╳
+	ignored      string // the takeoff dropped because land was pressed with it
+}
+
+// groundButtons arbitrates △, ⌑ and ╳ between two reads. A takeoff pressed
+// together with land loses, landing is the safe choice.
+func (c joystickConfig) groundButtons(state, prev joystick.State, flying bool) groundPress {
+	var g groundPress
+	g.land = c.pressed(state, prev, btnX)
+	if c.pressed(state, prev, btnSquare) {
+		if flying {
+			g.palmLand = true
+		} else if g.land {
+			g.ignored = "Throw takeoff"
+		} else {
+			g.throwTakeOff = true
+		}
+	}
+	if c.pressed(state, prev, btnTriangle) {
+		if g.land {
+			g.ignored = "Takeoff"
+		} else {
+			g.takeOff = true
+		}
+	}
+	return g
+}
+
+// unmappedPresses returns the device indices of buttons just pressed that map
+// to no logical button (or only to btnUnknown), for -jstest.
+func (c joystickConfig) unmappedPresses(state, prev joystick.State) []uint {
+	var mapped uint32
+	for btn, ix := range c.buttons {
+		if btn != btnUnknown {
+			mapped |= 1 << ix
+		}
+	}
+	var presses []uint
+	for ix := uint(0); ix < 32; ix++ {
+		bit := uint32(1) << ix
+		if state.Buttons&bit != 0 && prev.Buttons&bit == 0 && mapped&bit == 0 {
+			presses = append(presses, ix)
+		}
+	}
+	return presses
+}
+
+// released reports a falling edge of the given logical button between two reads.
+func (c joystickConfig) released(state, prev joystick.State, btn int) bool {
+	return !c.held(state, btn) && c.held(prev, btn)
 }
 
 var dualShock4Config = joystickConfig{
 	axes: []int{
 		axLeftX: 0, axLeftY: 1, axRightX: 3, axRightY: 4,
 	},
-	buttons: []uint{
+	buttons: map[int]uint{
 		btnX: 0, btnCircle: 1, btnTriangle: 2, btnSquare: 3, btnL1: 4,
-		btnL2: 6, btnR1: 5, btnR2: 7,
+		btnL2: 6, btnR1: 5, btnR2: 7, btnL3: 11, btnR3: 12,
 	},
-	features: []bool{
+	features: map[int]bool{
 		flipsEnabled: false,
 		homeEnabled:  false,
 	},
@@ -105,11 +468,11 @@ var eightBitDoSF30Pro = joystickConfig{
 		axLeftX: 0, axLeftY: 1, axRightX: 2, axRightY: 3,
 	},
 	// B, A, Y, X, L1, L2, R1, R2
-	buttons: []uint{
+	buttons: map[int]uint{
 		btnX: 0, btnCircle: 1, btnTriangle: 3, btnSquare: 2, btnL1: 4,
 		btnL2: 6, btnR1: 5, btnR2: 7, btnDL: 13, btnDR: 14, btnDU: 15, btnDD: 16,
 	},
-	features: []bool{
+	features: map[int]bool{
 		flipsEnabled: true,
 		homeEnabled:  false,
 	},
@@ -119,11 +482,11 @@ var dualShock4ConfigWin = joystickConfig{
 	axes: []int{
 		axLeftX: 0, axLeftY: 1, axRightX: 2, axRightY: 3,
 	},
-	buttons: []uint{
+	buttons: map[int]uint{
 		btnX: 1, btnCircle: 2, btnTriangle: 3, btnSquare: 0, btnL1: 4,
-		btnL2: 6, btnR1: 5, btnR2: 7,
+		btnL2: 6, btnR1: 5, btnR2: 7, btnL3: 10, btnR3: 11,
 	},
-	features: []bool{
+	features: map[int]bool{
 		flipsEnabled: false,
 		homeEnabled:  false,
 	},
@@ -134,11 +497,11 @@ var tflightHotasXConfig = joystickConfig{
 	axes: []int{
 		axLeftX: 4, axLeftY: 2, axRightX: 0, axRightY: 1,
 	},
-	buttons: []uint{
+	buttons: map[int]uint{
 		btnR1: 0, btnL1: 1, btnR3: 2, btnL3: 3, btnSquare: 4, btnX: 5,
 		btnCircle: 6, btnTriangle: 7, btnR2: 8, btnL2: 9,
 	},
-	features: []bool{
+	features: map[int]bool{
 		flipsEnabled: false,
 		homeEnabled:  false,
 	},
@@ -148,7 +511,7 @@ var tflightSteamControllerConfig = joystickConfig{
 	axes: []int{
 		axLeftX: 0, axLeftY: 1, axRightX: 2, axRightY: 3,
 	},
-	buttons: []uint{
+	buttons: map[int]uint{
 		btnR1: 7, btnL1: 6, btnR3: 14, btnL3: 13, btnSquare: 4, btnX: 2,
 		btnCircle: 3, btnTriangle: 5, btnR2: 9, btnL2: 8,
 
@@ -161,7 +524,7 @@ var tflightSteamControllerConfig = joystickConfig{
 		// BackL = 15
 		// BackR = 16
 	},
-	features: []bool{
+	features: map[int]bool{
 		flipsEnabled: true,
 		homeEnabled:  true,
 	},
@@ -176,12 +539,13 @@ Right Stick  Up/Down/Turn
 
 △            Takeoff
 ╳            Land
-○            Take Photo
+○            Take Photo (or start/stop recording in video mode, see -camtoggle)
 ⌑            Throw takeoff / Palm Land
 L1           Slow flight mode
 L2           Bounce (on/off)
 R1           Fast flight mode
-R2           Ultra slow (hold this button for lower sensitivity, does not change flight speed mode)
+R2           Ultra slow (hold this button for lower sensitivity, see -finemult, does not change flight speed mode)
+R3           Start/Stop timelapse (with -timelapse)
 
 Select       Set Home position
 Home         Fly to Home position (if set)
@@ -191,9 +555,87 @@ D-Pad Left    Flip left
 D-Pad Right   Flip right
 D-Pad Up      Flip forward
 D-Pad Down    Flip backward
+(a flip button pressed while another is held is ignored)
+
+The flip for each D-Pad direction can be changed with a "dpad_flips" object in
+the configuration file, e.g. {"dpad_flips": {"up": "backward"}}.  Flips are
+forward, backward, left, right, forward_left, forward_right, backward_left
+and backward_right.
+
+With -throttleaxis n, device axis n (a HOTAS throttle lever, say) controls
+up/down in place of the right stick's Y axis.  Centre the lever to hover.
+A lever or trigger that rests at one end can be named in -endaxes instead,
+e.g. -endaxes throttle or throttle=high: the rest end then hovers, the dead
+zone sits there and pushing the lever climbs, so it cannot descend.
+
+With -yawaxis n, device axis n (the twist of a flight stick, say) turns the
+drone in place of the right stick's X axis, twisting right turns right.
+
+With -tuneaxis n, device axis n (a spare dial, say) sets one stick setting
+while flying, shown on the status line: with -tuneparam max the stick travel
+from 10% at one end of the dial to 100% at the other, with expo the expo from
+0 to 1, with yaw the turn rate multiplier from 0 to 2.  The dial overrides
+the matching -slow and -fast options in both flight modes.
+
+With -lefthanded the left stick controls throttle and turning, the right stick
+moves forward/back/left/right, and D-Pad Left/Right flip right/left.  Buttons
+are otherwise unchanged.
+
+With -faceflips, for pads without a D-Pad, hold R2 and press
+△/╳/⌑/○ to flip forward/backward/left/right.  While R2 is held
+these buttons do not takeoff, land or take photos.
+
+Optional actions can be bound to any button with these options, using the button
+names x, circle, triangle, square, l1, l2, l3, r1, r2, r3, dleft, dright, dup,
+ddown, home, select or start.  They fire in addition to the button's usual action.
+
+-climbbtn     Take off and climb to -climbheight
+-camtoggle    Switch the camera between photo and video mode
+-fdlogbtn     Start/Stop logging flight data to a new CSV file
+-figure8btn   Figure-8: two orbit-like circles turning opposite ways
+-headingbtn   Hold for -holdms to save the current heading, tap to turn back to it
+-holdrecord   Record video only while the button is held
+-invertbtn    Turn inverted controls (all four axes reversed) on or off
+-orbitbtn     Orbit: circle sideways while turning to face the centre
+-panoramabtn  Panorama: turn slowly on the spot, with -timelapse photos
+-selfiebtn    Selfie: back away and up, take a photo, then come back
+-zeroyawbtn   Make the current heading 0°, -headingbtn turns back to it if no heading is saved
+
+-holdactions gives buttons a second action when held for -holdms, as a list
+of button=action pairs using the actions of -keyhelp, e.g. circle=record.
+A quick tap of such a button still does its usual action, on release.
+
+Camera joystick (-camjsid, sticks are ignored)
+
+○            Take Photo (or start/stop recording in video mode)
+△            Start/Stop recording to file
+╳            Open/Close video window
+L1           Normal video mode
+R1           Wide video mode
 `)
 }
 
+// jsTypeHints maps part of the name a controller reports to the -jstype that suits it.
+var jsTypeHints = []struct {
+	fragment, jsType string
+}{
+	{"wireless controller", "DualShock4"}, // the DualShock 4 just calls itself this
+	{"dualshock", "DualShock4"},
+	{"t.flight hotas", "HotasX"},
+	{"sf30 pro", "EightBitDoSF30Pro"},
+	{"steam controller", "SteamController"},
+}
+
+func suggestJsType(name string) string {
+	name = strings.ToLower(name)
+	for _, h := range jsTypeHints {
+		if strings.Contains(name, h.fragment) {
+			return h.jsType
+		}
+	}
+	return ""
+}
+
 func listJoysticks() {
 	for jsid := 0; jsid < 10; jsid++ {
 		js, err := joystick.Open(jsid)
@@ -203,38 +645,491 @@ func listJoysticks() {
 			}
 			return
 		}
-		fmt.Printf("Joystick ID: %d: Name: %s, Axes: %d, Buttons: %d\n", jsid, js.Name(), js.AxisCount(), js.ButtonCount())
+		fmt.Printf("Joystick ID: %d: Name: %s, Axes: %d, Buttons: %d", jsid, js.Name(), js.AxisCount(), js.ButtonCount())
+		if p, _, ok := profileFor(js.Name()); ok && p.JsType != "" {
+			fmt.Printf(", Profile: -jstype %s", p.JsType)
+		} else if jsType := suggestJsType(js.Name()); jsType != "" {
+			fmt.Printf(", Suggested: -jstype %s", jsType)
+		}
+		fmt.Println()
 		js.Close()
 	}
 }
 
 func setupJoystick(id int) bool {
-	if jsTypeFlag == nil || *jsTypeFlag == "" {
-		log.Fatalln("No joystick type supplied, please use -jstype option")
-	}
 	js, err = joystick.Open(id)
 	if err != nil {
 		log.Fatalf("Could not open specified joystick ID:%d\n", id)
 	}
-	switch *jsTypeFlag {
+	if p, name, ok := profileFor(js.Name()); ok {
+		log.Printf("Using the configured profile for joystick %s\n", name)
+		applyProfile(p)
+	}
+	if *jsTypeFlag == "" {
+		log.Fatalln("No joystick type supplied, please use -jstype option or a devices profile in the configuration")
+	}
+	jsConfig = configForType(*jsTypeFlag)
+	if *faceFlipsFlag {
+		jsConfig.features = copyFeatures(jsConfig.features)
+		jsConfig.features[faceFlipsEnabled] = true
+	}
+	if *unsignedAxesFlag {
+		jsConfig.features = copyFeatures(jsConfig.features)
+		jsConfig.features[unsignedAxes] = true
+	}
+	if *axisScaleFlag != "" {
+		if jsConfig.scale, err = parseAxisScale(*axisScaleFlag); err != nil {
+			badFlag("Bad -axisscale - %v", err)
+		}
+	}
+	if *tuneAxisFlag >= 0 {
+		jsConfig.features = copyFeatures(jsConfig.features)
+		jsConfig.features[liveTuning] = true
+		jsConfig.tuneAxis = *tuneAxisFlag
+	}
+	if *endAxesFlag != "" {
+		if jsConfig.ends, err = parseEndAxes(*endAxesFlag); err != nil {
+			badFlag("Bad -endaxes - %v", err)
+		}
+	}
+	if *leftHandedFlag {
+		mirrorControls()
+	}
+	if err := applyFlipConfig(config.DpadFlips); err != nil {
+		badFlag("Bad D-Pad flips in configuration - %v", err)
+	}
+	if *throttleAxisFlag >= 0 {
+		jsConfig.axes = withAxis(jsConfig.axes, axThrottle, *throttleAxisFlag)
+	}
+	if *yawAxisFlag >= 0 {
+		jsConfig.axes = withAxis(jsConfig.axes, axYaw, *yawAxisFlag)
+	}
+	if n := js.AxisCount(); n <= jsConfig.maxAxis() && !*jsValidate && !*jsDriftFlag {
+		badFlag("-jstype %s needs %d axes but %s has %d, check the mapping with -jsvalidate", *jsTypeFlag, jsConfig.maxAxis()+1, js.Name(), n)
+	}
+	// log.Printf("Set up looks good: \n")
+	return true
+}
+
+// setupCameraJoystick opens a second controller whose buttons only drive the camera.
+func setupCameraJoystick(id int) bool {
+	if *camJsTypeFlag == "" {
+		log.Fatalln("No camera joystick type supplied, please use -camjstype option")
+	}
+	camJs, err = joystick.Open(id)
+	if err != nil {
+		log.Fatalf("Could not open specified camera joystick ID:%d\n", id)
+	}
+	camJsConfig = configForType(*camJsTypeFlag)
+	return true
+}
+
+// pickFlip returns the flip button that has just been pressed, as long as it is
+// the only one of buttons held down. Two at once, up and down by accident say,
+// are ambiguous and ignored.
+func pickFlip(buttons []flipButton, state, prev joystick.State) (flipButton, bool) {
+	var (
+		picked flipButton
+		held   int
+		found  bool
+	)
+	for _, fb := range buttons {
+		if jsConfig.held(state, fb.btn) {
+			held++
+		}
+		if jsConfig.pressed(state, prev, fb.btn) {
+			picked, found = fb, true
+		}
+	}
+	if found && held > 1 {
+		log.Println("Flip ignored, more than one flip button pressed")
+		return flipButton{}, false
+	}
+	return picked, found
+}
+
+// mirrorControls sets up -lefthanded: the two sticks swap roles and the D-Pad
+// left/right flips change places to match.
+func mirrorControls() {
+	axes := append([]int(nil), jsConfig.axes...)
+	axes[axLeftX], axes[axRightX] = axes[axRightX], axes[axLeftX]
+	axes[axLeftY], axes[axRightY] = axes[axRightY], axes[axLeftY]
+	jsConfig.axes = axes
+	if jsConfig.scale != nil {
+		scale := append([]float64(nil), jsConfig.scale...)
+		scale[axLeftX], scale[axRightX] = scale[axRightX], scale[axLeftX]
+		scale[axLeftY], scale[axRightY] = scale[axRightY], scale[axLeftY]
+		jsConfig.scale = scale
+	}
+	if jsConfig.ends != nil {
+		ends := map[int]int{}
+		mirror := map[int]int{axLeftX: axRightX, axRightX: axLeftX, axLeftY: axRightY, axRightY: axLeftY, axThrottle: axThrottle, axYaw: axYaw}
+		for ax, sign := range jsConfig.ends {
+			ends[mirror[ax]] = sign
+		}
+		jsConfig.ends = ends
+	}
+	dpadFlipButtons = []flipButton{
+		{btnDU, tello.FlipForward},
+		{btnDD, tello.FlipBackward},
+		{btnDL, tello.FlipRight},
+		{btnDR, tello.FlipLeft},
+	}
+}
+
+// dpadNames are the D-Pad directions as named in the configuration file.
+var dpadNames = map[string]int{"up": btnDU, "down": btnDD, "left": btnDL, "right": btnDR}
+
+// applyFlipConfig changes which flip each D-Pad direction does, directions
+// not mentioned keep their flip.
+func applyFlipConfig(flips map[string]string) error {
+	if len(flips) == 0 {
+		return nil
+	}
+	mapped := append([]flipButton(nil), dpadFlipButtons...)
+	for dir, name := range flips {
+		btn, ok := dpadNames[dir]
+		if !ok {
+			return fmt.Errorf("unknown D-Pad direction <%s>, use up, down, left or right", dir)
+		}
+		ft, ok := flipByName(name)
+		if !ok {
+			return fmt.Errorf("unknown flip <%s> for D-Pad %s", name, dir)
+		}
+		for i := range mapped {
+			if mapped[i].btn == btn {
+				mapped[i].dir = ft
+			}
+		}
+	}
+	dpadFlipButtons = mapped
+	return nil
+}
+
+func flipByName(name string) (tello.FlipType, bool) {
+	for ft, n := range flipNames {
+		if n == name {
+			return ft, true
+		}
+	}
+	return 0, false
+}
+
+// copyFeatures lets a feature be changed without touching the shared controller definitions.
+func copyFeatures(features map[int]bool) map[int]bool {
+	c := make(map[int]bool, len(features))
+	for f, on := range features {
+		c[f] = on
+	}
+	return c
+}
+
+func configForType(jsType string) joystickConfig {
+	switch jsType {
 	case "DualShock4":
 		switch runtime.GOOS {
 		case "windows":
-			jsConfig = dualShock4ConfigWin
+			return dualShock4ConfigWin
 		default:
-			jsConfig = dualShock4Config
+			return dualShock4Config
 		}
 	case "HotasX":
-		jsConfig = tflightHotasXConfig
+		return tflightHotasXConfig
 	case "EightBitDoSF30Pro":
-		jsConfig = eightBitDoSF30Pro
+		return eightBitDoSF30Pro
 	case "SteamController":
-		jsConfig = tflightSteamControllerConfig
-	default:
-		log.Fatalf("Unknown joystick type <%s> supplied\n", *jsTypeFlag)
+		return tflightSteamControllerConfig
 	}
-	// log.Printf("Set up looks good: \n")
-	return true
+	log.Fatalf("Unknown joystick type <%s> supplied\n", jsType)
+	return joystickConfig{}
+}
+
+// validateJoystick checks every axis and button index used by the selected config
+// against what the opened device actually reports, printing a line for each problem.
+// It returns false if any index is out of range.
+func validateJoystick() bool {
+	ok := true
+	axCount, btnCount := js.AxisCount(), js.ButtonCount()
+	fmt.Printf("Validating -jstype %s against %s (Axes: %d, Buttons: %d)\n", *jsTypeFlag, js.Name(), axCount, btnCount)
+	for ax, ix := range jsConfig.axes {
+		if ix < 0 && ax >= axThrottle {
+			continue // optional and unused
+		}
+		if ix < 0 || ix >= axCount {
+			fmt.Printf("  axis %-14s index %d out of range (0-%d)\n", axisNames[ax], ix, axCount-1)
+			ok = false
+		}
+	}
+	if jsConfig.features[liveTuning] && jsConfig.tuneAxis >= axCount {
+		fmt.Printf("  axis %-14s index %d out of range (0-%d)\n", "Tune", jsConfig.tuneAxis, axCount-1)
+		ok = false
+	}
+	for btn := 0; btn < len(buttonNames); btn++ {
+		ix, mapped := jsConfig.buttons[btn]
+		if mapped && int(ix) >= btnCount {
+			fmt.Printf("  button %-12s index %d out of range (0-%d)\n", buttonNames[btn], ix, btnCount-1)
+			ok = false
+		}
+	}
+	if jsConfig.features[flipsEnabled] && !jsConfig.hasButtons(btnDL, btnDR, btnDU, btnDD) {
+		fmt.Println("  flips are enabled but the D-Pad buttons are not mapped")
+		ok = false
+	}
+	if jsConfig.features[homeEnabled] && !jsConfig.hasButtons(btnHome, btnSelect, btnStart) {
+		fmt.Println("  home is enabled but Home/Select/Start buttons are not mapped")
+		ok = false
+	}
+	if ok {
+		fmt.Println("  mapping OK")
+	}
+	return ok
+}
+
+const (
+	driftSampleTime = 3 * time.Second
+	driftOffCentre  = deadZone     // mean further than this from zero
+	driftNoisy      = deadZone / 4 // standard deviation above this
+)
+
+// measureDrift samples every axis of the joystick, which should be left
+// alone, and reports how far from centre and how noisy each one is at rest.
+// It only reports, nothing is changed.
+func measureDrift() {
+	n := js.AxisCount()
+	sum := make([]float64, n)
+	sumSq := make([]float64, n)
+	samples := 0
+	fmt.Printf("Sampling %d axes of %s for %v, leave the sticks alone...\n", n, js.Name(), driftSampleTime)
+	for end := time.Now().Add(driftSampleTime); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		state, err := js.Read()
+		if err != nil {
+			fmt.Printf("Error reading joystick: %v\n", err)
+			return
+		}
+		for i := 0; i < n && i < len(state.AxisData); i++ {
+			v := float64(state.AxisData[i])
+			sum[i] += v
+			sumSq[i] += v * v
+		}
+		samples++
+	}
+	used := map[int]string{}
+	for ax, ix := range jsConfig.axes {
+		if ax < len(axisNames) && axisNames[ax] != "" {
+			used[ix] = axisNames[ax]
+		}
+	}
+	for i := 0; i < n; i++ {
+		mean := sum[i] / float64(samples)
+		sd := math.Sqrt(math.Max(0, sumSq[i]/float64(samples)-mean*mean))
+		var notes []string
+		centre := 0.0
+		if jsConfig.features[unsignedAxes] {
+			centre = 32768
+		}
+		if centre == 0 && math.Abs(mean-32768) < driftOffCentre {
+			notes = append(notes, "CENTRED ON 32768, TRY -unsignedaxes")
+		} else if math.Abs(mean-centre) > driftOffCentre {
+			notes = append(notes, "OFF CENTRE")
+		}
+		if sd > driftNoisy {
+			notes = append(notes, "NOISY")
+		}
+		fmt.Printf("  axis %2d %-14s mean %7.0f  std dev %6.0f  %s\n", i, used[i], mean, sd, strings.Join(notes, ", "))
+	}
+	fmt.Printf("The dead zone is %d. Axes that are off centre may need a bigger dead zone or a new stick,\n", deadZone)
+	fmt.Println("noisy ones may be calmed with -filter. Triggers and throttle levers rest at an end, not the centre.")
+	showDeadZone()
+}
+
+// buttonDebouncer hides button flicker from worn controllers by only letting a
+// button change state once the raw reading has held steady for -debounce ms.
+type buttonDebouncer struct {
+	stable  uint32
+	last    uint32
+	changed [32]time.Time
+}
+
+func (d *buttonDebouncer) filter(raw uint32, now time.Time) uint32 {
+	delay := time.Duration(*debounceFlag) * time.Millisecond
+	for i := uint(0); i < 32; i++ {
+		bit := uint32(1) << i
+		if raw&bit != d.last&bit {
+			d.changed[i] = now
+		}
+		if now.Sub(d.changed[i]) >= delay {
+			d.stable = d.stable&^bit | raw&bit
+		}
+	}
+	d.last = raw
+	return d.stable
+}
+
+// holdAction is run when its button is held for -holdms rather than tapped.
+type holdAction struct {
+	name   string
+	action func()
+}
+
+var holdActions = map[int]holdAction{}
+
+// setupHoldActions parses -holdactions, a list of button=action pairs naming
+// the same actions as the key configuration.
+func setupHoldActions() {
+	if *holdActionsFlag == "" {
+		return
+	}
+	for _, pair := range strings.Split(*holdActionsFlag, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			badFlag("-holdactions entry <%s> should be button=action", pair)
+		}
+		btn, ok := buttonFlagNames[parts[0]]
+		if !ok {
+			badFlag("Unknown button <%s> for -holdactions, see -joyhelp", parts[0])
+		}
+		action, ok := keyActions[parts[1]]
+		if !ok {
+			badFlag("Unknown action <%s> for -holdactions, see -keyhelp", parts[1])
+		}
+		holdActions[btn] = holdAction{parts[1], action}
+	}
+}
+
+// pressTimer tells taps from holds for buttons with a hold action. Such a
+// button is hidden from the rest of readJoystick while down: held for -holdms
+// it runs the hold action, released sooner it appears pressed for one read so
+// that its usual action follows.
+type pressTimer struct {
+	down  map[int]time.Time
+	fired map[int]bool
+}
+
+func (p *pressTimer) filter(state *joystick.State, now time.Time, test bool) {
+	if p.down == nil {
+		p.down = map[int]time.Time{}
+		p.fired = map[int]bool{}
+	}
+	for btn, ha := range holdActions {
+		ix, ok := jsConfig.buttons[btn]
+		if !ok {
+			continue
+		}
+		bit := uint32(1) << ix
+		start, tracking := p.down[btn]
+		switch {
+		case state.Buttons&bit != 0:
+			if !tracking {
+				p.down[btn] = now
+			} else if !p.fired[btn] && now.Sub(start) >= time.Duration(*holdMsFlag)*time.Millisecond {
+				p.fired[btn] = true
+				if test {
+					fmt.Printf("%s held: %s\n", buttonNames[btn], ha.name)
+				} else {
+					ha.action()
+				}
+			}
+			state.Buttons &^= bit
+		case tracking:
+			if !p.fired[btn] {
+				state.Buttons |= bit // a tap, let it through for this read only
+			}
+			delete(p.down, btn)
+			delete(p.fired, btn)
+		}
+	}
+}
+
+// axisFilter is a moving average over the most recent readings of one axis,
+// used to calm controllers that jitter at rest.
+type axisFilter struct {
+	samples []int16
+	next    int
+	filled  int
+}
+
+func newAxisFilter(n int) *axisFilter {
+	return &axisFilter{samples: make([]int16, n)}
+}
+
+// add records a new reading and returns the average of the buffered readings.
+func (f *axisFilter) add(v int16) int16 {
+	f.samples[f.next] = v
+	f.next = (f.next + 1) % len(f.samples)
+	if f.filled < len(f.samples) {
+		f.filled++
+	}
+	var sum int32
+	for i := 0; i < f.filled; i++ {
+		sum += int32(f.samples[i])
+	}
+	return int16(sum / int32(f.filled))
+}
+
+// isRepeatStick reports whether sm can be skipped with -stickdedup because it
+// matches the last message sent and the keepalive interval has not yet passed.
+func isRepeatStick(sm, last tello.StickMessage, lastTime time.Time) bool {
+	if !*stickDedupFlag {
+		return false
+	}
+	return sm == last && time.Since(lastTime) < time.Duration(*stickKeepaliveFlag)*time.Millisecond
+}
+
+// stickMoved reports whether any axis of sm differs from last by at least
+// step, so that -jstest only prints readings that have really changed.
+func stickMoved(sm, last tello.StickMessage, step int) bool {
+	moved := func(a, b int16) bool {
+		d := int(a) - int(b)
+		return d >= step || -d >= step
+	}
+	return moved(sm.Lx, last.Lx) || moved(sm.Ly, last.Ly) || moved(sm.Rx, last.Rx) || moved(sm.Ry, last.Ry)
+}
+
+// easeToCentre lets an axis that has just been released decay towards zero by
+// the given factor each frame instead of snapping back, for gentler stops.
+func easeToCentre(sm *tello.StickMessage, prev tello.StickMessage, factor float64) {
+	ease := func(v *int16, last int16) {
+		if *v != 0 || last == 0 {
+			return
+		}
+		*v = int16(float64(last) * factor)
+		if intAbs(*v) < deadZone/2 {
+			*v = 0
+		}
+	}
+	ease(&sm.Lx, prev.Lx)
+	ease(&sm.Ly, prev.Ly)
+	ease(&sm.Rx, prev.Rx)
+	ease(&sm.Ry, prev.Ry)
+}
+
+// slewLimit stops any axis moving more than maxStep from its previous output in
+// one frame, so the drone accelerates and stops smoothly.
+func slewLimit(sm *tello.StickMessage, prev tello.StickMessage, maxStep int) {
+	slew := func(v *int16, last int16) {
+		d := int(*v) - int(last)
+		if d > maxStep {
+			*v = int16(int(last) + maxStep)
+		} else if d < -maxStep {
+			*v = int16(int(last) - maxStep)
+		}
+	}
+	slew(&sm.Lx, prev.Lx)
+	slew(&sm.Ly, prev.Ly)
+	slew(&sm.Rx, prev.Rx)
+	slew(&sm.Ry, prev.Ry)
+}
+
+// scaleAxis multiplies a stick value, clamping the result to the valid range.
+func scaleAxis(v int16, mult float64) int16 {
+	f := float64(v) * mult
+	if f > 32767 {
+		return 32767
+	}
+	if f < -32767 {
+		return -32767
+	}
+	return int16(f)
 }
 
 func intAbs(x int16) int16 {
@@ -244,84 +1139,167 @@ func intAbs(x int16) int16 {
 	return x
 }
 
-func readJoystick(test bool) {
+// readJoystick polls the main joystick until ctx is cancelled or the joystick is
+// lost for good, it then centres the sticks and closes the joystick.
+func readJoystick(ctx context.Context, test bool) {
 	var (
 		sm                 tello.StickMessage
 		jsState, prevState joystick.State
 		hovering           bool
+		lastSent           tello.StickMessage
+		lastSendTime       time.Time
 		err                error
+		filters            [4]*axisFilter // Lx, Ly, Rx, Ry
+		debounce           buttonDebouncer
+		presses            pressTimer
+		prevOut            tello.StickMessage
+		lastPrinted        tello.StickMessage
 	)
 
+	if *filterFlag > 1 {
+		for i := range filters {
+			filters[i] = newAxisFilter(*filterFlag)
+		}
+	}
+
+	defer func() {
+		if !test && stickChan != nil {
+			sendSticks(tello.StickMessage{})
+		}
+		if js != nil { // nil if reconnecting failed
+			js.Close()
+		}
+	}()
+
 	for {
 		jsState, err = js.Read()
+		if err == nil && len(jsState.AxisData) <= jsConfig.maxAxis() {
+			err = fmt.Errorf("only %d axes reported, -jstype %s needs %d", len(jsState.AxisData), *jsTypeFlag, jsConfig.maxAxis()+1)
+		}
 
 		if err != nil {
 			log.Printf("Error reading joystick: %v\n", err)
+			if test {
+				fmt.Printf("Error reading joystick: %v\n", err)
+				return
+			}
+			if !reconnectJoystick() {
+				return
+			}
+			continue
 		}
+		jsState.Buttons = debounce.filter(jsState.Buttons, time.Now())
+		presses.filter(&jsState, time.Now(), test)
 
-		if jsState.AxisData[jsConfig.axes[axLeftX]] == 32768 {
-			sm.Rx = 32767
-		} else {
-			sm.Rx = int16(jsState.AxisData[jsConfig.axes[axLeftX]])
+		// ignore the joystick entirely during -startupdelay, buttons held
+		// through it do not count as presses when it ends
+		if !test && startingUp() {
+			prevState = jsState
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(updatePeriodMs * time.Millisecond):
+			}
+			continue
 		}
 
-		if jsState.AxisData[jsConfig.axes[axLeftY]] == 32768 {
-			sm.Ry = -32767
-		} else {
-			sm.Ry = -int16(jsState.AxisData[jsConfig.axes[axLeftY]])
+		sm.Rx = jsConfig.stick(jsState, axLeftX, jsConfig.axes[axLeftX], false)
+		sm.Ry = jsConfig.stick(jsState, axLeftY, jsConfig.axes[axLeftY], true)
+		yawIx, yawAx := jsConfig.axes[axRightX], axRightX
+		if ix, ok := jsConfig.optionalAxis(axYaw); ok {
+			yawIx, yawAx = ix, axYaw
+		}
+		sm.Lx = jsConfig.stick(jsState, yawAx, yawIx, false)
+		throttleIx, throttleAx := jsConfig.axes[axRightY], axRightY
+		if ix, ok := jsConfig.throttleAxis(); ok {
+			throttleIx, throttleAx = ix, axThrottle
+		}
+		sm.Ly = jsConfig.stick(jsState, throttleAx, throttleIx, true)
+		if jsConfig.scale != nil {
+			sm.Rx = scaleAxis(sm.Rx, jsConfig.axisScale(axLeftX))
+			sm.Ry = scaleAxis(sm.Ry, jsConfig.axisScale(axLeftY))
+			sm.Lx = scaleAxis(sm.Lx, jsConfig.axisScale(yawAx))
+			sm.Ly = scaleAxis(sm.Ly, jsConfig.axisScale(throttleAx))
 		}
 
-		if jsState.AxisData[jsConfig.axes[axRightX]] == 32768 {
-			sm.Lx = 32767
-		} else {
-			sm.Lx = int16(jsState.AxisData[jsConfig.axes[axRightX]])
+		if filters[0] != nil {
+			sm.Lx = filters[0].add(sm.Lx)
+			sm.Ly = filters[1].add(sm.Ly)
+			sm.Rx = filters[2].add(sm.Rx)
+			sm.Ry = filters[3].add(sm.Ry)
 		}
 
-		if jsState.AxisData[jsConfig.axes[axRightY]] == 32768 {
-			sm.Ly = -32767
+		if *radialDeadzoneFlag {
+			radialDeadZone(&sm.Lx, &sm.Ly)
+			radialDeadZone(&sm.Rx, &sm.Ry)
 		} else {
-			sm.Ly = -int16(jsState.AxisData[jsConfig.axes[axRightY]])
+			squareDeadZone(&sm.Lx, &sm.Ly)
+			squareDeadZone(&sm.Rx, &sm.Ry)
 		}
 
-		if intAbs(sm.Lx) < deadZone {
-			sm.Lx = 0
-		}
-		if intAbs(sm.Ly) < deadZone {
-			sm.Ly = 0
-		}
-		if intAbs(sm.Rx) < deadZone {
-			sm.Rx = 0
+		// the instructor's sticks take over here so that tuning and -safelock
+		// apply to them as well
+		coached := false
+		if !test && useCoach {
+			if csm, ok := coach.sticks(); ok {
+				sm, coached = csm, true
+				jsState.Buttons = prevState.Buttons
+			}
 		}
-		if intAbs(sm.Ry) < deadZone {
-			sm.Ry = 0
+
+		tuning := currentTuning()
+		if jsConfig.features[liveTuning] {
+			tuning = tuning.tuned(*tuneParamFlag, jsConfig.axisValue(jsState.AxisData[jsConfig.tuneAxis]))
 		}
+		tuning.apply(&sm)
+		invert(&sm)
 
-		if jsState.Buttons&(1<<jsConfig.buttons[btnR2]) != 0 {
-			if test && prevState.Buttons&(1<<jsConfig.buttons[btnR2]) == 0 {
+		if !coached && jsConfig.held(jsState, btnR2) {
+			if test && !jsConfig.held(prevState, btnR2) {
 				fmt.Println("R2 pressed")
 			}
 
-			sm.Lx /= 3
-			sm.Ly /= 3
-			sm.Rx /= 3
-			sm.Ry /= 3
-		} else if test && prevState.Buttons&(1<<jsConfig.buttons[btnR2]) != 0 {
+			sm.Lx = scaleAxis(sm.Lx, *fineMultFlag)
+			sm.Ly = scaleAxis(sm.Ly, *fineMultFlag)
+			sm.Rx = scaleAxis(sm.Rx, *fineMultFlag)
+			sm.Ry = scaleAxis(sm.Ry, *fineMultFlag)
+		} else if test && jsConfig.held(prevState, btnR2) {
 			fmt.Println("R2 released")
 		}
 
+		capStick(&sm)
+
+		if *centerEaseFlag > 0 {
+			easeToCentre(&sm, prevOut, *centerEaseFlag)
+		}
+		// -recordslew only while recording, so control stays sharp otherwise
+		if *recordSlewFlag > 0 && !test && isRecording() {
+			slewLimit(&sm, prevOut, 32767*updatePeriodMs / *recordSlewFlag)
+		}
+		if !test && tumble.active() {
+			sm = tello.StickMessage{}
+		}
+		prevOut = sm
+
 		hover := sm.Lx == 0 && sm.Ly == 0 && sm.Rx == 0 && sm.Ry == 0
 
 		if test {
-			if !hover {
+			// readings flickering at the dead zone edge are printed once, not
+			// every time they cross it
+			if !hover && stickMoved(sm, lastPrinted, *jsTestStepFlag) {
 				fmt.Printf("JS: Lx: %d, Ly: %d, Rx: %d, Ry: %d\n", sm.Lx, sm.Ly, sm.Rx, sm.Ry)
+				lastPrinted = sm
 			}
 		} else {
 			if !hover && hovering {
-				// Make sure autopilot is turned off
+				// Make sure autopilot and any macro are turned off
 				drone.CancelAutoFlyToXY()
+				macros.cancel()
 			}
-			if !hover || !hovering {
+			if (!hover || !hovering) && !isRepeatStick(sm, lastSent, lastSendTime) {
 				stickChan <- sm
+				recordStick(sm)
+				lastSent, lastSendTime = sm, time.Now()
 			}
 			if hover && !hovering {
 				drone.Hover()
@@ -329,107 +1307,111 @@ func readJoystick(test bool) {
 			hovering = hover
 		}
 
-		if jsState.Buttons&(1<<jsConfig.buttons[btnL1]) != 0 && prevState.Buttons&(1<<jsConfig.buttons[btnL1]) == 0 {
+		for _, b := range boundActions {
+			if jsConfig.pressed(jsState, prevState, b.btn) {
+				if test {
+					fmt.Printf("%s pressed (%s)\n", buttonNames[b.btn], b.name)
+				} else {
+					b.action()
+				}
+			}
+			if b.release != nil && jsConfig.released(jsState, prevState, b.btn) {
+				if test {
+					fmt.Printf("%s released (%s)\n", buttonNames[b.btn], b.name)
+				} else {
+					b.release()
+				}
+			}
+		}
+
+		if jsConfig.pressed(jsState, prevState, btnL1) {
 			if test {
 				fmt.Println("L1 pressed")
 			} else {
-				drone.SetSlowMode()
+				setSlowMode()
 			}
 		}
-		if jsState.Buttons&(1<<jsConfig.buttons[btnL2]) != 0 && prevState.Buttons&(1<<jsConfig.buttons[btnL2]) == 0 {
+		if jsConfig.pressed(jsState, prevState, btnL2) {
 			if test {
 				fmt.Println("L2 pressed")
 			} else {
-				drone.Bounce()
+				bounce()
 			}
 		}
-		if jsState.Buttons&(1<<jsConfig.buttons[btnR1]) != 0 && prevState.Buttons&(1<<jsConfig.buttons[btnR1]) == 0 {
+		if jsConfig.pressed(jsState, prevState, btnR1) {
 			if test {
 				fmt.Println("R1 pressed")
 			} else {
-				drone.SetFastMode()
+				setFastMode()
 			}
 		}
 
-		if jsState.Buttons&(1<<jsConfig.buttons[btnL3]) != 0 && prevState.Buttons&(1<<jsConfig.buttons[btnL3]) == 0 {
+		if jsConfig.pressed(jsState, prevState, btnL3) {
 			if test {
 				fmt.Println("L3 pressed")
 			}
 		}
-		if jsState.Buttons&(1<<jsConfig.buttons[btnR3]) != 0 && prevState.Buttons&(1<<jsConfig.buttons[btnR3]) == 0 {
+		if jsConfig.pressed(jsState, prevState, btnR3) {
 			if test {
 				fmt.Println("R3 pressed")
+			} else {
+				lapse.toggle()
 			}
 		}
 
-		if jsState.Buttons&(1<<jsConfig.buttons[btnSquare]) != 0 && prevState.Buttons&(1<<jsConfig.buttons[btnSquare]) == 0 {
-			if test {
-				fmt.Println("⌑ pressed")
-			} else {
-				if drone.GetFlightData().Flying {
-					drone.PalmLand()
+		// With face flips R2 turns the face buttons into flips
+		faceFlips := jsConfig.features[faceFlipsEnabled] && jsConfig.held(jsState, btnR2)
+		if faceFlips {
+			if ff, ok := pickFlip(faceFlipButtons, jsState, prevState); ok {
+				if test {
+					fmt.Printf("R2+%s pressed\n", buttonNames[ff.btn])
 				} else {
-					drone.ThrowTakeOff()
+					flip(ff.dir)
 				}
 			}
 		}
-		if jsState.Buttons&(1<<jsConfig.buttons[btnTriangle]) != 0 && prevState.Buttons&(1<<jsConfig.buttons[btnTriangle]) == 0 {
-			if test {
-				fmt.Println("△ pressed")
-			} else {
-				drone.TakeOff()
+
+		if !faceFlips && test {
+			for _, btn := range []int{btnSquare, btnTriangle, btnCircle, btnX} {
+				if jsConfig.pressed(jsState, prevState, btn) {
+					fmt.Printf("%s pressed\n", buttonNames[btn])
+				}
 			}
-		}
-		if jsState.Buttons&(1<<jsConfig.buttons[btnCircle]) != 0 && prevState.Buttons&(1<<jsConfig.buttons[btnCircle]) == 0 {
-			if test {
-				fmt.Println("○ pressed")
-			} else {
-				drone.TakePicture()
+		} else if !faceFlips {
+			g := jsConfig.groundButtons(jsState, prevState, drone.GetFlightData().Flying)
+			if g.ignored != "" {
+				log.Printf("%s ignored, land pressed at the same time\n", g.ignored)
 			}
-		}
-		if jsState.Buttons&(1<<jsConfig.buttons[btnX]) != 0 && prevState.Buttons&(1<<jsConfig.buttons[btnX]) == 0 {
-			if test {
-				fmt.Println("╳ pressed")
-			} else {
-				drone.Land()
+			if g.palmLand {
+				palmLand()
+			} else if g.throwTakeOff {
+				throwTakeOff()
+			}
+			if g.takeOff {
+				takeOff()
+			}
+			if jsConfig.pressed(jsState, prevState, btnCircle) {
+				cameraShutter()
+			}
+			if g.land {
+				land()
 			}
 		}
 
 		// Flip Feature
 		if jsConfig.features[flipsEnabled] {
-			if jsState.Buttons&(1<<jsConfig.buttons[btnDL]) != 0 && prevState.Buttons&(1<<jsConfig.buttons[btnDL]) == 0 {
-				if test {
-					fmt.Println("D-Pad Left pressed")
-				} else {
-					drone.LeftFlip()
-				}
-			}
-			if jsState.Buttons&(1<<jsConfig.buttons[btnDR]) != 0 && prevState.Buttons&(1<<jsConfig.buttons[btnDR]) == 0 {
+			if df, ok := pickFlip(dpadFlipButtons, jsState, prevState); ok {
 				if test {
-					fmt.Println("D-Pad Right pressed")
+					fmt.Printf("%s pressed\n", buttonNames[df.btn])
 				} else {
-					drone.RightFlip()
-				}
-			}
-			if jsState.Buttons&(1<<jsConfig.buttons[btnDU]) != 0 && prevState.Buttons&(1<<jsConfig.buttons[btnDU]) == 0 {
-				if test {
-					fmt.Println("D-Pad Up pressed")
-				} else {
-					drone.ForwardFlip()
-				}
-			}
-			if jsState.Buttons&(1<<jsConfig.buttons[btnDD]) != 0 && prevState.Buttons&(1<<jsConfig.buttons[btnDD]) == 0 {
-				if test {
-					fmt.Println("D-Pad Down pressed")
-				} else {
-					drone.BackFlip()
+					flip(df.dir)
 				}
 			}
 		}
 
 		// Set or Fly Home Feature
 		if jsConfig.features[homeEnabled] {
-			if jsState.Buttons&(1<<jsConfig.buttons[btnSelect]) != 0 && prevState.Buttons&(1<<jsConfig.buttons[btnSelect]) == 0 {
+			if jsConfig.pressed(jsState, prevState, btnSelect) {
 				if test {
 					fmt.Println("Select pressed")
 				} else {
@@ -439,7 +1421,7 @@ func readJoystick(test bool) {
 					}
 				}
 			}
-			if jsState.Buttons&(1<<jsConfig.buttons[btnHome]) != 0 && prevState.Buttons&(1<<jsConfig.buttons[btnHome]) == 0 {
+			if jsConfig.pressed(jsState, prevState, btnHome) {
 				if test {
 					fmt.Println("Home pressed")
 				} else {
@@ -453,7 +1435,7 @@ func readJoystick(test bool) {
 					}
 				}
 			}
-			if jsState.Buttons&(1<<jsConfig.buttons[btnStart]) != 0 && prevState.Buttons&(1<<jsConfig.buttons[btnStart]) == 0 {
+			if jsConfig.pressed(jsState, prevState, btnStart) {
 				if test {
 					fmt.Println("Start pressed")
 				} else {
@@ -462,13 +1444,82 @@ func readJoystick(test bool) {
 			}
 		}
 
+		if test {
+			for _, ix := range jsConfig.unmappedPresses(jsState, prevState) {
+				fmt.Printf("Unmapped button index %d pressed (not in -jstype %s)\n", ix, *jsTypeFlag)
+			}
+		}
+
 		prevState = jsState
 
+		period := updatePeriodMs * time.Millisecond
 		if test {
 			// Avoid spam of stdout output
-			time.Sleep(150 * time.Millisecond)
-		} else {
-			time.Sleep(updatePeriodMs)
+			period = 150 * time.Millisecond
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(period):
+		}
+	}
+}
+
+// readCameraJoystick polls the camera operator's controller and turns its button
+// presses into camera actions, leaving flying to the main joystick.
+func readCameraJoystick() {
+	var (
+		prevState joystick.State
+		debounce  buttonDebouncer
+	)
+
+	for {
+		jsState, err := camJs.Read()
+		if err != nil {
+			log.Printf("Error reading camera joystick: %v\n", err)
+			reopenCameraJoystick()
+			continue
+		}
+		jsState.Buttons = debounce.filter(jsState.Buttons, time.Now())
+
+		if camJsConfig.pressed(jsState, prevState, btnCircle) {
+			cameraShutter()
+		}
+		if camJsConfig.pressed(jsState, prevState, btnTriangle) {
+			toggleRecording()
+		}
+		if camJsConfig.pressed(jsState, prevState, btnX) {
+			togglePlayer()
+		}
+		if camJsConfig.pressed(jsState, prevState, btnL1) {
+			setWideVideo(false)
+		}
+		if camJsConfig.pressed(jsState, prevState, btnR1) {
+			setWideVideo(true)
+		}
+
+		prevState = jsState
+		time.Sleep(updatePeriodMs * time.Millisecond)
+	}
+}
+
+const camJsMaxWait = 30 * time.Second
+
+// reopenCameraJoystick closes the camera joystick after a read error and keeps
+// trying to open it again, waiting longer after each failure. Losing it only
+// costs the camera buttons, so there is no need to give up.
+func reopenCameraJoystick() {
+	camJs.Close()
+	for wait := time.Second; ; wait *= 2 {
+		if wait > camJsMaxWait {
+			wait = camJsMaxWait
+		}
+		time.Sleep(wait)
+		cj, err := joystick.Open(*camJsIDFlag)
+		if err == nil {
+			camJs = cj
+			log.Println("Camera joystick reopened")
+			return
 		}
 	}
 }
@@ -0,0 +1,169 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"flag"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/simulatedsimian/joystick"
+)
+
+func variance(vs []int16) float64 {
+	var sum float64
+	for _, v := range vs {
+		sum += float64(v)
+	}
+	mean := sum / float64(len(vs))
+	var sq float64
+	for _, v := range vs {
+		d := float64(v) - mean
+		sq += d * d
+	}
+	return sq / float64(len(vs))
+}
+
+func TestAxisFilterReducesNoise(t *testing.T) {
+	const centre, noise = 5000, 1500
+	rng := rand.New(rand.NewSource(1))
+	f := newAxisFilter(8)
+	var in, out []int16
+	for i := 0; i < 1000; i++ {
+		v := int16(centre + rng.Intn(2*noise+1) - noise)
+		got := f.add(v)
+		if i >= 8 { // skip the readings taken while the buffer fills
+			in = append(in, v)
+			out = append(out, got)
+		}
+	}
+	vin, vout := variance(in), variance(out)
+	if vout >= vin {
+		t.Errorf("filtered variance %.0f is not below input variance %.0f", vout, vin)
+	}
+}
+
+func TestScaleAxisDefaultMatchesDivide(t *testing.T) {
+	mult := 1.0 / 3
+	if f := flag.Lookup("finemult"); f != nil {
+		mult, _ = strconv.ParseFloat(f.DefValue, 64)
+	}
+	for _, v := range []int16{-32767, -5, -4, -3, -2, -1, 0, 1, 2, 3, 4, 5, 6, 32767} {
+		if got, want := scaleAxis(v, mult), v/3; got != want {
+			t.Errorf("scaleAxis(%d, default) = %d, want %d as with /3", v, got, want)
+		}
+	}
+}
+
+func TestScaleAxis(t *testing.T) {
+	tests := []struct {
+		v    int16
+		mult float64
+		want int16
+	}{
+		{1, 0.5, 0},
+		{-1, 0.5, 0},
+		{2, 0.5, 1},
+		{-2, 0.5, -1},
+		{3, 0.5, 1},
+		{-3, 0.5, -1},
+		{5, 0.5, 2},
+		{-5, 0.5, -2},
+		{4, 0.25, 1},
+		{-5, 0.25, -1},
+		{5, 1.5, 7},
+		{-5, 1.5, -7},
+		{30000, 2, 32767},
+		{-30000, 2, -32767},
+	}
+	for _, tt := range tests {
+		if got := scaleAxis(tt.v, tt.mult); got != tt.want {
+			t.Errorf("scaleAxis(%d, %g) = %d, want %d", tt.v, tt.mult, got, tt.want)
+		}
+	}
+}
+
+func TestDeadZones(t *testing.T) {
+	tests := []struct {
+		name             string
+		x, y             int16
+		squareX, squareY int16
+		radialX, radialY int16
+	}{
+		{"centre", 0, 0, 0, 0, 0, 0},
+		// a diagonal whose axes are each inside the zone but together are outside
+		{"small diagonal", 1500, 1500, 0, 0, 91, 91},
+		{"small diagonal negative", -1500, 1500, 0, 0, -91, 91},
+		{"inside both", 1000, -1000, 0, 0, 0, 0},
+		// one axis past the zone: square keeps it unscaled, radial rescales both
+		{"one axis out", 2500, 1000, 2500, 0, 685, 274},
+		{"at the edge", deadZone, 0, deadZone, 0, 0, 0},
+		{"edge plus one", deadZone + 1, 0, deadZone + 1, 0, 1, 0},
+		{"full diagonal", 23170, -23170, 23170, -23170, 23170, -23170},
+		{"half travel", 17000, 0, 17000, 0, 15975, 0},
+		{"full travel", 32767, 0, 32767, 0, 32767, 0},
+		{"full negative", -32767, 0, -32767, 0, -32767, 0},
+	}
+	for _, tt := range tests {
+		x, y := tt.x, tt.y
+		squareDeadZone(&x, &y)
+		if x != tt.squareX || y != tt.squareY {
+			t.Errorf("%s: squareDeadZone(%d, %d) = %d, %d, want %d, %d", tt.name, tt.x, tt.y, x, y, tt.squareX, tt.squareY)
+		}
+		x, y = tt.x, tt.y
+		radialDeadZone(&x, &y)
+		if x != tt.radialX || y != tt.radialY {
+			t.Errorf("%s: radialDeadZone(%d, %d) = %d, %d, want %d, %d", tt.name, tt.x, tt.y, x, y, tt.radialX, tt.radialY)
+		}
+	}
+}
+
+func TestGroundButtons(t *testing.T) {
+	cfg := joystickConfig{buttons: map[int]uint{btnX: 0, btnSquare: 1, btnTriangle: 2}}
+	const x, square, triangle = 1 << 0, 1 << 1, 1 << 2
+	tests := []struct {
+		name      string
+		prev, cur uint32
+		flying    bool
+		want      groundPress
+	}{
+		{"nothing", 0, 0, false, groundPress{}},
+		{"takeoff", 0, triangle, false, groundPress{takeOff: true}},
+		{"throw takeoff", 0, square, false, groundPress{throwTakeOff: true}},
+		{"palm land", 0, square, true, groundPress{palmLand: true}},
+		{"land", 0, x, true, groundPress{land: true}},
+		{"takeoff held", triangle, triangle, false, groundPress{}},
+		{"takeoff with land", 0, triangle | x, false, groundPress{land: true, ignored: "Takeoff"}},
+		{"throw with land", 0, square | x, false, groundPress{land: true, ignored: "Throw takeoff"}},
+		{"palm land with land", 0, square | x, true, groundPress{palmLand: true, land: true}},
+		// land already held does not block a fresh takeoff
+		{"takeoff while land held", x, triangle | x, false, groundPress{takeOff: true}},
+	}
+	for _, tt := range tests {
+		got := cfg.groundButtons(joystick.State{Buttons: tt.cur}, joystick.State{Buttons: tt.prev}, tt.flying)
+		if got != tt.want {
+			t.Errorf("%s: groundButtons = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
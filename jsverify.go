@@ -0,0 +1,222 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/simulatedsimian/joystick"
+)
+
+// -jsverify walks through the selected -jstype mapping before connecting to
+// the drone: each mapped button is to be pressed and each stick pushed in
+// turn, and anything landing on an unexpected index or reading backwards is
+// reported. With "new" a controller and mapping that passed once are not
+// checked again.
+
+const (
+	verifyTimeout  = 8 * time.Second
+	verifyPushed   = 20000 // raw movement from rest that counts as a push
+	verifyReleased = 8000
+)
+
+const verifiedFile = "verified_joysticks.json"
+
+// verifyAxes are the stick movements checked, as readJoystick sees them.
+var verifyAxes = []struct {
+	prompt string
+	ax     int
+	flip   bool
+}{
+	{"Push the roll stick fully right", axLeftX, false},
+	{"Push the pitch stick fully forward", axLeftY, true},
+	{"Push the yaw stick fully right (or twist it right)", axRightX, false},
+	{"Push the throttle fully up", axRightY, true},
+}
+
+// verifyJoystick runs -jsverify and exits if the mapping looks wrong.
+func verifyJoystick() {
+	key := js.Name() + "|" + *jsTypeFlag
+	verified := readVerified()
+	if *jsVerifyFlag == "new" && verified[key] {
+		return
+	}
+	fmt.Printf("Checking -jstype %s on %s, wait %v to skip a step\n", *jsTypeFlag, js.Name(), verifyTimeout)
+	problems := 0
+	for btn := 0; btn < len(buttonNames); btn++ {
+		ix, mapped := jsConfig.buttons[btn]
+		if !mapped || btn == btnUnknown {
+			continue
+		}
+		fmt.Printf("Press %s... ", buttonNames[btn])
+		got, ok := waitButton()
+		switch {
+		case !ok:
+			fmt.Println("skipped")
+		case got != ix:
+			fmt.Printf("WRONG: index %d was pressed, %s is mapped to %d\n", got, buttonNames[btn], ix)
+			problems++
+		default:
+			fmt.Println("ok")
+		}
+	}
+	// a separate throttle or yaw axis replaces the stick's
+	optional := map[int]int{axRightY: axThrottle, axRightX: axYaw}
+	for _, va := range verifyAxes {
+		ax, ix := va.ax, jsConfig.axes[va.ax]
+		if opt, ok := optional[va.ax]; ok {
+			if oix, ok := jsConfig.optionalAxis(opt); ok {
+				ax, ix = opt, oix
+			}
+		}
+		fmt.Printf("%s... ", va.prompt)
+		got, state, ok := waitAxis()
+		switch {
+		case !ok:
+			fmt.Println("skipped")
+		case got != ix:
+			fmt.Printf("WRONG: axis %d moved, %s is mapped to %d\n", got, axisNames[ax], ix)
+			problems++
+		case jsConfig.stick(state, ax, ix, va.flip) < verifyReleased:
+			fmt.Println("WRONG: it reads backwards")
+			problems++
+		default:
+			fmt.Println("ok")
+		}
+	}
+	if problems == 0 {
+		fmt.Println("Mapping looks right")
+		verified[key] = true
+		writeVerified(verified)
+		return
+	}
+	fmt.Printf("%d problem(s) found, try another -jstype, -lefthanded or -unsignedaxes. Check the sticks with -jsdrift now? [y/N] ", problems)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y") {
+		measureDrift()
+	}
+	os.Exit(1)
+}
+
+// waitButton returns the device index of the next button pressed.
+func waitButton() (uint, bool) {
+	prev, err := js.Read()
+	if err != nil {
+		return 0, false
+	}
+	for end := time.Now().Add(verifyTimeout); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		state, err := js.Read()
+		if err != nil {
+			return 0, false
+		}
+		if pressed := state.Buttons &^ prev.Buttons; pressed != 0 {
+			ix := uint(0)
+			for pressed&1 == 0 {
+				pressed >>= 1
+				ix++
+			}
+			waitRelease(func(s joystick.State) bool { return s.Buttons == 0 })
+			return ix, true
+		}
+		prev = state
+	}
+	return 0, false
+}
+
+// waitAxis returns the device axis pushed furthest from where it rested,
+// with the state at that moment.
+func waitAxis() (int, joystick.State, bool) {
+	rest, err := js.Read()
+	if err != nil {
+		return 0, rest, false
+	}
+	moved := func(s joystick.State) (int, int) {
+		best, dist := 0, 0
+		for i := 0; i < len(s.AxisData) && i < len(rest.AxisData); i++ {
+			d := s.AxisData[i] - rest.AxisData[i]
+			if d < 0 {
+				d = -d
+			}
+			if d > dist {
+				best, dist = i, d
+			}
+		}
+		return best, dist
+	}
+	for end := time.Now().Add(verifyTimeout); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		state, err := js.Read()
+		if err != nil {
+			return 0, state, false
+		}
+		if ix, dist := moved(state); dist >= verifyPushed {
+			waitRelease(func(s joystick.State) bool { _, d := moved(s); return d < verifyReleased })
+			return ix, state, true
+		}
+	}
+	return 0, rest, false
+}
+
+// waitRelease waits, up to verifyTimeout, for the controller to be let go.
+func waitRelease(released func(joystick.State) bool) {
+	for end := time.Now().Add(verifyTimeout); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		if state, err := js.Read(); err != nil || released(state) {
+			return
+		}
+	}
+}
+
+// readVerified returns the controller and mapping pairs that have passed -jsverify.
+func readVerified() map[string]bool {
+	verified := map[string]bool{}
+	dir, err := configDir()
+	if err != nil {
+		return verified
+	}
+	if buf, err := ioutil.ReadFile(filepath.Join(dir, verifiedFile)); err == nil {
+		json.Unmarshal(buf, &verified)
+	}
+	return verified
+}
+
+func writeVerified(verified map[string]bool) {
+	dir, err := configDir()
+	if err == nil {
+		err = os.MkdirAll(dir, 0755)
+	}
+	if err == nil {
+		var buf []byte
+		if buf, err = json.MarshalIndent(verified, "", "  "); err == nil {
+			err = ioutil.WriteFile(filepath.Join(dir, verifiedFile), buf, 0644)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Cannot remember the check - %v\n", err)
+	}
+}
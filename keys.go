@@ -0,0 +1,104 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/Anty0/tello"
+	termbox "github.com/nsf/termbox-go"
+)
+
+// keyActions are the keyboard commands that can be bound to character keys.
+// "quit" is handled by the main loop itself.
+var keyActions = map[string]func(){
+	"refresh": func() {
+		termbox.Sync()
+		displayStaticFields()
+		displayDataFields()
+	},
+	"bounce":       bounce,
+	"takeoff":      func() { takeOff() },
+	"throwtakeoff": throwTakeOff,
+	"land":         land,
+	"palmland":     palmLand,
+	"timelapse":    lapse.toggle,
+	"stickview":    toggleStickView,
+	"up":           func() { noteCommand("up"); drone.Up(capPct(keyPct * 2)) },
+	"turnleft":     func() { noteCommand("turnleft"); drone.TurnLeft(capPct(keyPct * 2)) },
+	"down":         func() { noteCommand("down"); drone.Down(capPct(keyPct * 2)) },
+	"turnright":    func() { noteCommand("turnright"); drone.TurnRight(capPct(keyPct * 2)) },
+	"photo":        func() { takePhoto() },
+	"video":        func() { startVideo(true, false) },
+	"record":       func() { startVideo(false, true) },
+	"videorecord":  func() { startVideo(true, true) },
+	"smart360":     func() { noteCommand("smart360"); drone.StartSmartVideo(tello.Sv360) },
+	"flipforward":  func() { flip(tello.FlipForward) },
+	"flipback":     func() { flip(tello.FlipBackward) },
+	"flipleft":     func() { flip(tello.FlipLeft) },
+	"flipright":    func() { flip(tello.FlipRight) },
+	"fast":         setFastMode,
+	"slow":         setSlowMode,
+	"widevideo":    func() { setWideVideo(!wideVideo) },
+	"lifetime":     toggleLifetime,
+	"setheading":   setHeading,
+	"toheading":    toHeading,
+	"fdlog":        fdLogger.toggle,
+	"lastcmd":      toggleCmdPanel,
+	"selftest":     selfTest,
+	"zeroyaw":      zeroYaw,
+	"blackbox":     saveBlackBox,
+	"view":         toggleView,
+}
+
+// keyBindings maps character keys to actions, the defaults are shown by -keyhelp.
+var keyBindings = map[rune]string{
+	'q': "quit", 'r': "refresh", 'b': "bounce", 't': "takeoff", 'o': "throwtakeoff",
+	'l': "land", 'p': "palmland", 'i': "timelapse", 'j': "stickview",
+	'w': "up", 'a': "turnleft", 's': "down", 'd': "turnright",
+	'f': "photo", 'v': "video", 'c': "record", 'x': "videorecord", '0': "smart360",
+	'1': "flipforward", '2': "flipback", '3': "flipleft", '4': "flipright",
+	'+': "fast", '-': "slow", '=': "widevideo", 'g': "lifetime", 'k': "lastcmd", 'y': "selftest", 'n': "zeroyaw",
+	'u': "blackbox", 'm': "view",
+}
+
+// applyKeyConfig overrides the default key bindings with those from the
+// config file, an empty action name unbinds the key.
+func applyKeyConfig(keys map[string]string) error {
+	for key, action := range keys {
+		ch, size := utf8.DecodeRuneInString(key)
+		if size == 0 || size != len(key) {
+			return fmt.Errorf("key binding <%s> must be a single character", key)
+		}
+		if _, ok := keyActions[action]; !ok && action != "quit" && action != "" {
+			return fmt.Errorf("unknown action <%s> for key <%s>", action, key)
+		}
+		if action == "" {
+			delete(keyBindings, ch)
+		} else {
+			keyBindings[ch] = action
+		}
+	}
+	return nil
+}
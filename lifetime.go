@@ -0,0 +1,208 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Anty0/tello"
+)
+
+// Lifetime totals are kept in lifetime.json in configDir and updated as each
+// flight ends or photo is taken. Other instances may be running, so each update
+// re-reads the file under a lock file and replaces it in one rename.
+
+type lifetimeStats struct {
+	Flights    int     `json:"flights"`
+	FlightSecs float64 `json:"flight_seconds"`
+	Photos     int     `json:"photos"`
+}
+
+const (
+	lifetimeFile = "lifetime.json"
+	lockWait     = 2 * time.Second
+	staleLock    = 10 * time.Second // a lock this old was left by an instance that died
+)
+
+var (
+	lifetimeMu   sync.Mutex
+	lifetime     lifetimeStats // totals as last read or written
+	lifetimeWG   sync.WaitGroup
+	showLifetime bool
+	flightMu     sync.Mutex
+	wasFlying    bool
+	flightStart  time.Time
+)
+
+// noteLifetime counts a flight, and its duration, each time the drone lands.
+// Flights of the -simdrone are not counted.
+func noteLifetime(fd tello.FlightData) {
+	if *simDroneFlag {
+		return
+	}
+	flightMu.Lock()
+	defer flightMu.Unlock()
+	switch {
+	case fd.Flying && !wasFlying:
+		flightStart = time.Now()
+	case !fd.Flying && wasFlying:
+		saveLifetime(lifetimeStats{Flights: 1, FlightSecs: time.Since(flightStart).Seconds()})
+	}
+	wasFlying = fd.Flying
+}
+
+func countPhoto() {
+	countSessionPhoto()
+	if !*simDroneFlag {
+		saveLifetime(lifetimeStats{Photos: 1})
+	}
+}
+
+// saveLifetime adds delta to the saved totals in the background, see finishLifetime.
+func saveLifetime(delta lifetimeStats) {
+	lifetimeWG.Add(1)
+	go func() {
+		defer lifetimeWG.Done()
+		addLifetime(delta)
+	}()
+}
+
+// finishLifetime counts a flight still under way at exit, up to now, and waits
+// for every update to be written.
+func finishLifetime() {
+	flightMu.Lock()
+	if wasFlying {
+		saveLifetime(lifetimeStats{Flights: 1, FlightSecs: time.Since(flightStart).Seconds()})
+		wasFlying = false
+	}
+	flightMu.Unlock()
+	lifetimeWG.Wait()
+}
+
+// addLifetime adds delta to the saved totals.
+func addLifetime(delta lifetimeStats) {
+	lifetimeMu.Lock()
+	defer lifetimeMu.Unlock()
+	dir, err := configDir()
+	if err != nil {
+		log.Printf("Cannot save lifetime stats - %v\n", err)
+		return
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Cannot save lifetime stats - %v\n", err)
+		return
+	}
+	filename := filepath.Join(dir, lifetimeFile)
+	unlock, err := lockFile(filename + ".lock")
+	if err != nil {
+		log.Printf("Cannot save lifetime stats - %v\n", err)
+		return
+	}
+	defer unlock()
+
+	totals, err := readLifetime(filename)
+	if err != nil {
+		log.Printf("Cannot read lifetime stats, not updating them - %v\n", err)
+		return
+	}
+	totals.Flights += delta.Flights
+	totals.FlightSecs += delta.FlightSecs
+	totals.Photos += delta.Photos
+	buf, err := json.MarshalIndent(totals, "", "  ")
+	if err != nil {
+		log.Printf("Cannot save lifetime stats - %v\n", err)
+		return
+	}
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		log.Printf("Cannot save lifetime stats - %v\n", err)
+		return
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		log.Printf("Cannot save lifetime stats - %v\n", err)
+		return
+	}
+	lifetime = totals
+}
+
+// readLifetime returns the saved totals, zero if there are none yet.
+func readLifetime(filename string) (lifetimeStats, error) {
+	var totals lifetimeStats
+	buf, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return totals, nil
+	}
+	if err != nil {
+		return totals, err
+	}
+	err = json.Unmarshal(buf, &totals)
+	return totals, err
+}
+
+// lockFile creates name exclusively, waiting a while for any other holder.
+func lockFile(name string) (unlock func(), err error) {
+	deadline := time.Now().Add(lockWait)
+	for {
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(name) }, nil
+		}
+		if fi, serr := os.Stat(name); serr == nil && time.Since(fi.ModTime()) > staleLock {
+			os.Remove(name)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is locked", name)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// toggleLifetime switches the bottom line between session and lifetime stats.
+func toggleLifetime() {
+	lifetimeMu.Lock()
+	defer lifetimeMu.Unlock()
+	showLifetime = !showLifetime
+	if !showLifetime {
+		return
+	}
+	if dir, err := configDir(); err == nil {
+		if totals, err := readLifetime(filepath.Join(dir, lifetimeFile)); err == nil {
+			lifetime = totals
+		}
+	}
+}
+
+func getLifetime() (lifetimeStats, bool) {
+	lifetimeMu.Lock()
+	defer lifetimeMu.Unlock()
+	return lifetime, showLifetime
+}
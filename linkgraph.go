@@ -0,0 +1,95 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	termbox "github.com/nsf/termbox-go"
+)
+
+// With -linkgraph the blank row under the battery details shows the WiFi
+// strength the drone reports over the last minute as a sparkline, so a
+// weakening link shows before it fails. Seconds in which telemetry was late
+// are drawn in red.
+
+const (
+	linkGraphRow    = 5
+	linkGraphLabelX = 7
+	linkGraphX      = 16
+	linkSamples     = 60 // one a second
+	linkLateAfter   = 500 * time.Millisecond
+)
+
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+type linkSample struct {
+	strength uint8
+	late     bool
+	valid    bool
+}
+
+type linkHistory struct {
+	mu      sync.Mutex
+	samples [linkSamples]linkSample
+	next    int
+}
+
+var link linkHistory
+
+// sampleLink records the link quality once a second.
+func sampleLink() {
+	for range time.Tick(time.Second) {
+		s := linkSample{
+			strength: drone.GetFlightData().WifiStrength,
+			late:     telemetryAge() > linkLateAfter,
+			valid:    true,
+		}
+		link.mu.Lock()
+		link.samples[link.next] = s
+		link.next = (link.next + 1) % linkSamples
+		link.mu.Unlock()
+	}
+}
+
+func displayLinkGraph() {
+	tbprint(linkGraphLabelX, linkGraphRow, termbox.ColorWhite, termbox.ColorDefault, "WiFi 1m:")
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	for i := 0; i < linkSamples; i++ {
+		s := link.samples[(link.next+i)%linkSamples]
+		ch, fg := ' ', termbox.ColorGreen
+		if s.valid {
+			level := int(s.strength) * len(sparkLevels) / 101
+			ch = sparkLevels[level]
+			if s.strength < 50 {
+				fg = termbox.ColorYellow
+			}
+		}
+		if s.late {
+			fg = termbox.ColorRed
+		}
+		termbox.SetCell(linkGraphX+i, linkGraphRow, ch, fg, termbox.ColorDefault)
+	}
+}
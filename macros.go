@@ -0,0 +1,389 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Anty0/tello"
+)
+
+// Macros fly canned manoeuvres by feeding timed stick positions to the drone.
+// They have no position feedback so their paths are only approximate. Any
+// pilot stick input, or a land command, cancels the running macro.
+
+type macroRunner struct {
+	mu   sync.Mutex
+	name string
+	stop chan struct{}
+}
+
+var macros macroRunner
+
+// start runs f in the background unless another macro is already running.
+func (m *macroRunner) start(name string, f func(stop <-chan struct{}) bool) {
+	if stickChan == nil {
+		log.Printf("Macro %s needs joystick control\n", name)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		log.Printf("Macro %s not started, %s is still running\n", name, m.name)
+		return
+	}
+	m.name = name
+	m.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		log.Printf("Macro %s started\n", name)
+		if f(stop) {
+			log.Printf("Macro %s finished\n", name)
+		} else {
+			log.Printf("Macro %s cancelled\n", name)
+		}
+		sendSticks(tello.StickMessage{})
+		m.mu.Lock()
+		if m.stop == stop {
+			m.stop = nil
+		}
+		m.mu.Unlock()
+	}(m.stop)
+}
+
+// cancel stops the running macro, if any.
+func (m *macroRunner) cancel() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// running returns the name of the running macro, if any.
+func (m *macroRunner) running() (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.name, m.stop != nil
+}
+
+// holdSticks keeps sending sm for d, it returns false if the macro was cancelled.
+// Macros are held to the -safelock cap like the joystick.
+func holdSticks(stop <-chan struct{}, sm tello.StickMessage, d time.Duration) bool {
+	capStick(&sm)
+	ticker := time.NewTicker(updatePeriodMs * time.Millisecond)
+	defer ticker.Stop()
+	end := time.Now().Add(d)
+	for time.Now().Before(end) {
+		sendSticks(sm)
+		select {
+		case <-stop:
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+func pctToStick(pct int) int16 {
+	return int16(32767 * pct / 100)
+}
+
+// orbitMacro circles sideways while turning the other way so that the drone keeps
+// facing the centre, the radius follows from the ratio of -orbitspeed to -orbityaw.
+func orbitMacro(stop <-chan struct{}) bool {
+	sm := tello.StickMessage{Rx: pctToStick(*orbitSpeedFlag), Lx: -pctToStick(*orbitYawFlag)}
+	return holdSticks(stop, sm, time.Duration(*orbitSecsFlag)*time.Second)
+}
+
+// figure8Macro flies -figure8loops figure-8s, each made of two circles of
+// -figure8secs. The drone moves sideways as in an orbit and reversing the turn
+// halfway makes the path curve back the other way.
+func figure8Macro(stop <-chan struct{}) bool {
+	v, yaw := pctToStick(*orbitSpeedFlag), pctToStick(*orbitYawFlag)
+	circle := time.Duration(*figure8SecsFlag) * time.Second
+	for i := 0; i < *figure8LoopsFlag; i++ {
+		if !holdSticks(stop, tello.StickMessage{Rx: v, Lx: -yaw}, circle) ||
+			!holdSticks(stop, tello.StickMessage{Rx: v, Lx: yaw}, circle) {
+			return false
+		}
+	}
+	return true
+}
+
+// selfieMacro backs away and climbs, takes a photo once settled and then flies
+// the reverse path back, distance being set by -selfiespeed and -selfiesecs.
+func selfieMacro(stop <-chan struct{}) bool {
+	v := pctToStick(*selfieSpeedFlag)
+	leg := time.Duration(*selfieSecsFlag) * time.Second
+	settle := time.Second
+	if !holdSticks(stop, tello.StickMessage{Ry: -v, Ly: v / 2}, leg) ||
+		!holdSticks(stop, tello.StickMessage{}, settle) {
+		return false
+	}
+	takePhoto()
+	return holdSticks(stop, tello.StickMessage{}, settle) &&
+		holdSticks(stop, tello.StickMessage{Ry: v, Ly: -v / 2}, leg)
+}
+
+// panoramaMacro turns on the spot at a steady -panoramayaw for -panoramasecs,
+// taking a photo every -timelapse seconds on the way round if that is set.
+func panoramaMacro(stop <-chan struct{}) bool {
+	spin := tello.StickMessage{Lx: pctToStick(*panoramaYawFlag)}
+	left := time.Duration(*panoramaSecsFlag) * time.Second
+	interval := left
+	if *timelapseFlag > 0 {
+		interval = time.Duration(*timelapseFlag) * time.Second
+	}
+	for left > 0 {
+		d := interval
+		if d > left {
+			d = left
+		}
+		if !holdSticks(stop, spin, d) {
+			return false
+		}
+		left -= d
+		if *timelapseFlag > 0 && left > 0 {
+			if err := takePhoto(); err != nil {
+				log.Printf("Panorama photo failed: %v\n", err)
+			}
+		}
+	}
+	return true
+}
+
+const (
+	headingTolerance = 3    // degrees
+	headingGain      = 0.02 // stick fraction per degree of error
+	headingMaxStick  = 0.5
+	headingTimeout   = 15 * time.Second
+)
+
+var (
+	headingMu     sync.Mutex
+	targetHeading int16
+	headingSet    bool
+	yawZero       int16 // the raw yaw shown as 0°, see zeroYaw
+	yawZeroed     bool
+)
+
+// zeroYaw makes the direction the drone now faces 0° in the display, and the
+// heading toHeading turns to when none has been saved.
+func zeroYaw() {
+	yaw := drone.GetFlightData().IMU.Yaw
+	headingMu.Lock()
+	yawZero, yawZeroed = yaw, true
+	headingMu.Unlock()
+	log.Printf("Heading zeroed at raw yaw %d°\n", yaw)
+	setAlert("Heading zeroed", 2*time.Second)
+}
+
+// relativeYaw is yaw measured from the zeroed heading.
+func relativeYaw(yaw int16) int {
+	headingMu.Lock()
+	defer headingMu.Unlock()
+	return yawError(yaw, yawZero)
+}
+
+// setHeading remembers the current yaw as the target for toHeading.
+func setHeading() {
+	yaw := drone.GetFlightData().IMU.Yaw
+	headingMu.Lock()
+	targetHeading, headingSet = yaw, true
+	headingMu.Unlock()
+	log.Printf("Heading %d° saved\n", relativeYaw(yaw))
+	setAlert(fmt.Sprintf("Heading %d° saved", relativeYaw(yaw)), 2*time.Second)
+}
+
+// toHeading turns the drone back to the saved heading. The IMU yaw drifts
+// over a flight, by several degrees after a few minutes, so the result is
+// only as repeatable as that allows.
+func toHeading() {
+	headingMu.Lock()
+	target, ok := targetHeading, headingSet
+	if !ok && yawZeroed {
+		target, ok = yawZero, true
+	}
+	headingMu.Unlock()
+	if !ok {
+		log.Println("No heading saved")
+		return
+	}
+	macros.start("heading", headingMacro(target))
+}
+
+// headingMacro turns at a rate proportional to the yaw error until within tolerance.
+func headingMacro(target int16) func(stop <-chan struct{}) bool {
+	return func(stop <-chan struct{}) bool {
+		deadline := time.Now().Add(headingTimeout)
+		for {
+			diff := yawError(target, drone.GetFlightData().IMU.Yaw)
+			if diff >= -headingTolerance && diff <= headingTolerance {
+				return true
+			}
+			if time.Now().After(deadline) {
+				log.Println("Heading not reached in time")
+				return false
+			}
+			rate := math.Max(-headingMaxStick, math.Min(headingMaxStick, float64(diff)*headingGain))
+			if !holdSticks(stop, tello.StickMessage{Lx: int16(rate * 32767)}, updatePeriodMs*time.Millisecond) {
+				return false
+			}
+		}
+	}
+}
+
+// yawError is the shortest turn, in degrees, from yaw to target.
+func yawError(target, yaw int16) int {
+	diff := (int(target) - int(yaw)) % 360
+	if diff > 180 {
+		diff -= 360
+	} else if diff < -180 {
+		diff += 360
+	}
+	return diff
+}
+
+const (
+	takeoffTimeout = 10 * time.Second
+	climbTimeout   = 30 * time.Second
+)
+
+// takeoffToHeight takes off and then climbs at -climbspeed until the reported
+// height reaches cm.
+func takeoffToHeight(cm int) func(stop <-chan struct{}) bool {
+	return func(stop <-chan struct{}) bool {
+		if !takeOff() {
+			return false
+		}
+		deadline := time.Now().Add(takeoffTimeout)
+		for !drone.GetFlightData().Flying {
+			if time.Now().After(deadline) {
+				log.Println("Climb abandoned, drone did not take off")
+				return false
+			}
+			if !holdSticks(stop, tello.StickMessage{}, updatePeriodMs*time.Millisecond) {
+				return false
+			}
+		}
+		climb := tello.StickMessage{Ly: pctToStick(*climbSpeedFlag)}
+		deadline = time.Now().Add(climbTimeout)
+		// height is reported in decimetres
+		for int(drone.GetFlightData().Height)*10 < cm {
+			if time.Now().After(deadline) {
+				log.Println("Climb abandoned, target height not reached in time")
+				return false
+			}
+			if !holdSticks(stop, climb, updatePeriodMs*time.Millisecond) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+const (
+	selfTestConfirm = 5 * time.Second
+	selfTestClimb   = 10 * time.Second // longest wait for takeoff to finish
+	selfTestSpeed   = 30               // percent
+	selfTestLeg     = 1500 * time.Millisecond
+)
+
+// selfTestArmed is when the self test was last asked for, by keyboard or joystick.
+var (
+	selfTestMu    sync.Mutex
+	selfTestArmed time.Time
+)
+
+// selfTest needs -selftest and a second press within selfTestConfirm, since
+// it really flies: it takes off, flies a small box, takes a photo and lands.
+func selfTest() {
+	if !*selfTestFlag {
+		setAlert("Self test needs -selftest", 3*time.Second)
+		return
+	}
+	selfTestMu.Lock()
+	confirmed := time.Since(selfTestArmed) <= selfTestConfirm
+	if confirmed {
+		selfTestArmed = time.Time{}
+	} else {
+		selfTestArmed = time.Now()
+	}
+	selfTestMu.Unlock()
+	if !confirmed {
+		setAlert("Self test flies a 1m box - press again to start", selfTestConfirm)
+		return
+	}
+	macros.start("selftest", selfTestMacro)
+}
+
+// selfTestMacro checks control, telemetry, photos and the connection in one
+// short flight, reporting each step on the status line. Moving a stick
+// cancels it, leaving the drone hovering.
+func selfTestMacro(stop <-chan struct{}) bool {
+	step := func(msg string) {
+		log.Printf("Self test: %s\n", msg)
+		setAlert("SELF TEST: "+msg, 10*time.Second)
+	}
+	if !drone.GetFlightData().Flying {
+		step("taking off")
+		if !takeOff() {
+			step("takeoff refused")
+			return false
+		}
+		deadline := time.Now().Add(selfTestClimb)
+		for fd := drone.GetFlightData(); !fd.Flying || fd.Height < 3; fd = drone.GetFlightData() {
+			if time.Now().After(deadline) {
+				step("drone did not take off")
+				return false
+			}
+			if !holdSticks(stop, tello.StickMessage{}, time.Second/2) {
+				return false
+			}
+		}
+	}
+	step("flying a box")
+	v := pctToStick(selfTestSpeed)
+	for _, sm := range []tello.StickMessage{{Ry: v}, {Rx: v}, {Ry: -v}, {Rx: -v}} {
+		if !holdSticks(stop, sm, selfTestLeg) || !holdSticks(stop, tello.StickMessage{}, time.Second) {
+			return false
+		}
+	}
+	step("taking a photo")
+	photo := "ok"
+	if err := takePhoto(); err != nil {
+		photo = "FAILED"
+	}
+	telemetry := "ok"
+	if telemetryAge() > time.Second {
+		telemetry = "STALE"
+	}
+	step(fmt.Sprintf("landing - photo %s, telemetry %s", photo, telemetry))
+	land()
+	return true
+}
@@ -0,0 +1,76 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"github.com/Anty0/tello"
+	termbox "github.com/nsf/termbox-go"
+)
+
+// With -mousecontrol dragging in the terminal window acts as a pair of sticks,
+// the left half being pitch/roll and the right half throttle/yaw. The video
+// window belongs to mplayer so its mouse events are not available to us.
+
+// mouseStick turns a mouse event into stick positions for the drone, centring
+// the sticks when the button is released.
+func mouseStick(ev termbox.Event) {
+	switch ev.Key {
+	case termbox.MouseLeft:
+		sendSticks(mouseToStick(ev.MouseX, ev.MouseY))
+	case termbox.MouseRelease:
+		sendSticks(tello.StickMessage{})
+	}
+}
+
+// mouseToStick measures x,y from the centre of its half of the window, the
+// edges of each half being full stick travel.
+func mouseToStick(x, y int) tello.StickMessage {
+	w, h := termbox.Size()
+	half := w / 2
+	cx := half / 2
+	if x >= half {
+		cx += half
+	}
+	sx := axisFromOffset(x-cx, half/2)
+	sy := axisFromOffset(h/2-y, h/2)
+	var sm tello.StickMessage
+	if x < half {
+		sm.Rx, sm.Ry = sx, sy
+	} else {
+		sm.Lx, sm.Ly = sx, sy
+	}
+	capStick(&sm)
+	return sm
+}
+
+func axisFromOffset(offset, max int) int16 {
+	if max <= 0 {
+		return 0
+	}
+	if offset > max {
+		offset = max
+	} else if offset < -max {
+		offset = -max
+	}
+	return int16(32767 * offset / max)
+}
@@ -0,0 +1,107 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The joystick package does not report controller batteries, but on Linux the
+// kernel lists wireless controllers (DualShock 4 and other HID devices) under
+// /sys/class/power_supply with a scope of "Device", as opposed to the laptop's
+// own "System" battery. Elsewhere the indicator is simply not shown.
+
+const padBatteryPeriod = 30 * time.Second
+
+var (
+	padBattMu  sync.Mutex
+	padBattPct = -1 // -1 while unknown
+)
+
+// readPadBattery returns the lowest capacity of any device battery found.
+func readPadBattery() (int, bool) {
+	if runtime.GOOS != "linux" {
+		return 0, false
+	}
+	dirs, _ := filepath.Glob("/sys/class/power_supply/*")
+	lowest, found := 100, false
+	for _, dir := range dirs {
+		scope, err := ioutil.ReadFile(filepath.Join(dir, "scope"))
+		if err != nil || strings.TrimSpace(string(scope)) != "Device" {
+			continue
+		}
+		buf, err := ioutil.ReadFile(filepath.Join(dir, "capacity"))
+		if err != nil {
+			continue
+		}
+		pct, err := strconv.Atoi(strings.TrimSpace(string(buf)))
+		if err != nil {
+			continue
+		}
+		if pct < lowest {
+			lowest = pct
+		}
+		found = true
+	}
+	return lowest, found
+}
+
+// watchPadBattery polls the controller battery, alerting as it falls below -padbattery.
+func watchPadBattery() {
+	warned := false
+	for {
+		pct, ok := readPadBattery()
+		if !ok {
+			pct = -1
+		}
+		padBattMu.Lock()
+		padBattPct = pct
+		padBattMu.Unlock()
+		low := ok && pct < *padBatteryFlag
+		if low && !warned {
+			log.Printf("Controller battery low: %d%%\n", pct)
+			setAlert(fmt.Sprintf("Controller battery low (%d%%) - land soon", pct), 10*time.Second)
+			noteWarning("controller battery low")
+		}
+		warned = low
+		time.Sleep(padBatteryPeriod)
+	}
+}
+
+// padBatteryStatus is the status line text for the controller battery, empty if unknown.
+func padBatteryStatus() string {
+	padBattMu.Lock()
+	defer padBattMu.Unlock()
+	if padBattPct < 0 {
+		return ""
+	}
+	return fmt.Sprintf("Pad %d%%", padBattPct)
+}
@@ -0,0 +1,91 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Anty0/tello"
+)
+
+// With -photolog each photo's number in the session, which is also its order
+// among the files saved on exit, is written to a CSV file in -mediadir with
+// where the drone was at the time: the position its visual odometry has
+// reckoned from takeoff, its height and its heading (relative to any zeroed
+// yaw). The same is sent as a photo event with -eventjson.
+
+var (
+	photoLogMu sync.Mutex
+	photoLog   *csv.Writer
+	photoFile  *os.File
+)
+
+func openPhotoLog() error {
+	filename := filepath.Join(*mediaDirFlag, fmt.Sprintf("tello_photos_%s.csv", time.Now().Format(time.RFC3339)))
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	photoFile, photoLog = f, csv.NewWriter(f)
+	log.Printf("Logging photo positions to %s\n", filename)
+	return photoLog.Write([]string{"Photo", "Time", "X", "Y", "Z", "Height", "Yaw"})
+}
+
+// logPhoto records the position of photo number seq.
+func logPhoto(seq int, fd tello.FlightData) {
+	yaw := relativeYaw(fd.IMU.Yaw)
+	emitEvent("photo", map[string]interface{}{
+		"number": seq, "x": fd.MVO.PositionX, "y": fd.MVO.PositionY, "z": fd.MVO.PositionZ,
+		"height_m": float32(fd.Height) / 10, "yaw": yaw,
+	})
+	if !*photoLogFlag {
+		return
+	}
+	photoLogMu.Lock()
+	defer photoLogMu.Unlock()
+	if photoLog == nil {
+		if err := openPhotoLog(); err != nil {
+			log.Printf("Cannot write photo log - %v\n", err)
+			return
+		}
+	}
+	photoLog.Write([]string{strconv.Itoa(seq), time.Now().Format("15:04:05.000"),
+		fmt.Sprintf("%f", fd.MVO.PositionX), fmt.Sprintf("%f", fd.MVO.PositionY), fmt.Sprintf("%f", fd.MVO.PositionZ),
+		fmt.Sprintf("%.1f", float32(fd.Height)/10), strconv.Itoa(yaw)})
+	photoLog.Flush()
+}
+
+func closePhotoLog() {
+	photoLogMu.Lock()
+	defer photoLogMu.Unlock()
+	if photoFile != nil {
+		photoFile.Close()
+	}
+}
@@ -0,0 +1,133 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// The tello package has no hook for its raw traffic, so for -rawlog we point it
+// at a local UDP relay which passes control packets to and from the drone and
+// logs each one, with a timestamp and direction, on the way through. Video
+// arrives on its own port and is not logged.
+
+type rawLogger struct {
+	mu  sync.Mutex
+	out io.WriteCloser
+}
+
+func (r *rawLogger) packet(dir string, buf []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(r.out, "%s %s %s\n", time.Now().Format(time.RFC3339Nano), dir, hex.EncodeToString(buf))
+}
+
+// startRawLog starts the relay and returns the address to connect to in place of the drone.
+func startRawLog(filename, droneIP string, dronePort int) (string, int, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return "", 0, err
+	}
+	rl := &rawLogger{out: f}
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.ParseIP(droneIP), Port: dronePort})
+	if err != nil {
+		f.Close()
+		return "", 0, err
+	}
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		f.Close()
+		conn.Close()
+		return "", 0, err
+	}
+
+	var (
+		clientMu sync.Mutex
+		client   *net.UDPAddr
+	)
+	go func() {
+		buf := make([]byte, 2048)
+		for failing := false; ; {
+			n, addr, err := relay.ReadFromUDP(buf)
+			if err != nil {
+				if relayStopped(err, &failing) {
+					return
+				}
+				continue
+			}
+			failing = false
+			clientMu.Lock()
+			client = addr
+			clientMu.Unlock()
+			rl.packet(">", buf[:n])
+			conn.Write(buf[:n])
+		}
+	}()
+	go func() {
+		buf := make([]byte, 2048)
+		for failing := false; ; {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if relayStopped(err, &failing) {
+					return
+				}
+				continue
+			}
+			failing = false
+			rl.packet("<", buf[:n])
+			clientMu.Lock()
+			addr := client
+			clientMu.Unlock()
+			if addr != nil {
+				relay.WriteToUDP(buf[:n], addr)
+			}
+		}
+	}()
+	local := relay.LocalAddr().(*net.UDPAddr)
+	return local.IP.String(), local.Port, nil
+}
+
+// relayStopped reports whether a read error ends the relay. Anything but the
+// socket closing is taken to be passing, such as the port unreachable that a
+// drone not yet up, or briefly out of reach, sends back; it is logged once per
+// run of errors and the read retried after a pause.
+func relayStopped(err error, failing *bool) bool {
+	if errors.Is(err, net.ErrClosed) {
+		log.Printf("Raw log relay stopped - %v\n", err)
+		return true
+	}
+	if !*failing {
+		log.Printf("Raw log relay read failed, retrying - %v\n", err)
+		*failing = true
+	}
+	time.Sleep(100 * time.Millisecond)
+	return false
+}
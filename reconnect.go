@@ -0,0 +1,187 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Anty0/tello"
+	"github.com/simulatedsimian/joystick"
+)
+
+// Lost links to the drone or the joystick are retried according to
+// -reconnectattempts and -reconnectdelay. If every attempt fails we land,
+// if the drone is flying, rather than retry forever.
+
+const linkTimeout = 3 * time.Second // telemetry silence that counts as a lost drone link
+
+type reconnectState struct {
+	mu      sync.Mutex
+	what    string
+	attempt int
+}
+
+var reconnecting reconnectState
+
+// controlIP and controlPort are where the control link was first connected,
+// which is the -rawlog relay rather than the drone when raw logging.
+var (
+	controlIP   string
+	controlPort int
+)
+
+// retry calls try until it succeeds or the attempts run out, reporting progress in the UI.
+func retry(what string, try func() error) bool {
+	defer reconnecting.set("", 0)
+	for attempt := 1; *reconnectAttemptsFlag == 0 || attempt <= *reconnectAttemptsFlag; attempt++ {
+		reconnecting.set(what, attempt)
+		err := try()
+		if err == nil {
+			log.Printf("Reconnected to %s after %d attempt(s)\n", what, attempt)
+			return true
+		}
+		log.Printf("Reconnect to %s, attempt %d failed - %v\n", what, attempt, err)
+		time.Sleep(time.Duration(*reconnectDelayFlag) * time.Second)
+	}
+	log.Printf("Giving up reconnecting to %s\n", what)
+	setAlert(fmt.Sprintf("Lost %s - giving up", what), time.Minute)
+	noteWarning("lost " + what)
+	if drone.GetFlightData().Flying {
+		land()
+	}
+	return false
+}
+
+func (r *reconnectState) set(what string, attempt int) {
+	r.mu.Lock()
+	r.what, r.attempt = what, attempt
+	r.mu.Unlock()
+}
+
+// status returns the UI text while a reconnection is under way.
+func (r *reconnectState) status() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.what == "" {
+		return ""
+	}
+	if *reconnectAttemptsFlag == 0 {
+		return fmt.Sprintf("RECONNECTING %s (%d)", r.what, r.attempt)
+	}
+	return fmt.Sprintf("RECONNECTING %s (%d/%d)", r.what, r.attempt, *reconnectAttemptsFlag)
+}
+
+// watchDroneLink reconnects to the drone when telemetry stops arriving.
+// The flight data stream and stick listener carry on over the new connection.
+func watchDroneLink() {
+	for {
+		time.Sleep(time.Second)
+		if !telemetryStarted() || telemetryAge() < linkTimeout {
+			continue
+		}
+		if retry("drone", reconnectDrone) {
+			continue
+		}
+		// the last telemetry we had is all we know about whether it is flying
+		if !*landOnReconnectFlag || !drone.GetFlightData().Flying {
+			return
+		}
+		landWhenBack()
+	}
+}
+
+func reconnectDrone() error {
+	drone.ControlDisconnect()
+	if err := drone.ControlConnect(controlIP, controlPort, localControlPort); err != nil {
+		return err
+	}
+	time.Sleep(time.Second)
+	if telemetryAge() >= time.Second {
+		return fmt.Errorf("no telemetry after connecting")
+	}
+	return nil
+}
+
+// landWhenBack keeps trying to reach a drone that was flying when we gave up
+// on it and sends land as soon as it answers, for -landonreconnect. This is
+// best effort, the link may well drop again before the command gets through.
+func landWhenBack() {
+	log.Println("Drone lost while flying, will land it if it comes back")
+	for attempt := 1; ; attempt++ {
+		reconnecting.set("drone to land it", attempt)
+		if err := reconnectDrone(); err == nil {
+			break
+		}
+		time.Sleep(time.Duration(*reconnectDelayFlag) * time.Second)
+	}
+	reconnecting.set("", 0)
+	log.Println("Drone is back, landing it")
+	setAlert("Drone is back - landing", 10*time.Second)
+	land()
+}
+
+// reconnectJoystick reopens the main joystick after a read error, centring the
+// sticks meanwhile so the drone is not left flying on the last input.
+func reconnectJoystick() bool {
+	if stickChan != nil {
+		sendSticks(tello.StickMessage{})
+	}
+	js.Close()
+	var back chan bool
+	if *landOnJsLossFlag > 0 && drone.GetFlightData().Flying {
+		back = make(chan bool, 1)
+		go landAfterGrace(back)
+	}
+	ok := retry("joystick", func() error {
+		var err error
+		js, err = joystick.Open(*jsIDFlag)
+		return err
+	})
+	if back != nil {
+		back <- ok
+	}
+	return ok
+}
+
+// landAfterGrace counts down -landonjsloss seconds in the UI and lands unless
+// the joystick comes back first, so a brief USB glitch does not end the flight.
+func landAfterGrace(back chan bool) {
+	for left := *landOnJsLossFlag; left > 0; left-- {
+		setAlert(fmt.Sprintf("Joystick lost - landing in %ds", left), 2*time.Second)
+		select {
+		case ok := <-back:
+			if ok {
+				setAlert("Joystick back", 3*time.Second)
+			}
+			return
+		case <-time.After(time.Second):
+		}
+	}
+	log.Println("Joystick not back in time, landing")
+	setAlert("Joystick lost - landing", 10*time.Second)
+	noteWarning("lost joystick")
+	land()
+}
@@ -0,0 +1,131 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// With -rumble the joystick vibrates on events worth noticing without looking
+// down: a low battery, a lost drone, a flip and a tumble. Each event plays a
+// pattern of steps, which the "rumble" object in the configuration file can
+// replace, e.g. {"rumble": {"flip": [{"ms": 100, "strong": 0, "weak": 80}]}},
+// as can a device profile's for that controller alone.
+
+// rumbleStep vibrates the strong (low frequency) and weak (high frequency)
+// motors at the given percentages for ms, both at 0 is a pause.
+type rumbleStep struct {
+	Ms     int `json:"ms"`
+	Strong int `json:"strong"`
+	Weak   int `json:"weak"`
+}
+
+var rumblePatterns = map[string][]rumbleStep{
+	"battery":  {{300, 100, 100}, {200, 0, 0}, {300, 100, 100}, {200, 0, 0}, {300, 100, 100}},
+	"linklost": {{1000, 100, 0}},
+	"flip":     {{120, 0, 70}},
+	"tumble":   {{150, 100, 100}, {100, 0, 0}, {150, 100, 100}, {100, 0, 0}, {150, 100, 100}},
+}
+
+// rumbler drives a controller's vibration motors, magnitudes are 0 to 0xffff.
+type rumbler interface {
+	rumble(strong, weak uint16, d time.Duration) error
+	close()
+}
+
+var rumbleQueue chan []rumbleStep
+
+// setupRumble opens the joystick's vibration motors and applies the patterns
+// from the configuration file, later ones taking precedence.
+func setupRumble(jsID int, configured ...map[string][]rumbleStep) error {
+	for _, patterns := range configured {
+		if err := setRumblePatterns(patterns); err != nil {
+			return err
+		}
+	}
+	r, err := openRumble(jsID)
+	if err != nil {
+		return err
+	}
+	rumbleQueue = make(chan []rumbleStep, 1)
+	go playRumble(r)
+	return nil
+}
+
+func setRumblePatterns(patterns map[string][]rumbleStep) error {
+	for name, steps := range patterns {
+		if _, ok := rumblePatterns[name]; !ok {
+			return fmt.Errorf("unknown rumble event <%s>, options are battery, linklost, flip and tumble", name)
+		}
+		for _, st := range steps {
+			if st.Ms <= 0 || st.Strong < 0 || st.Strong > 100 || st.Weak < 0 || st.Weak > 100 {
+				return fmt.Errorf("rumble %s: ms must be positive and strong and weak 0 to 100", name)
+			}
+		}
+		rumblePatterns[name] = steps
+	}
+	return nil
+}
+
+func playRumble(r rumbler) {
+	defer r.close()
+	for steps := range rumbleQueue {
+		for _, st := range steps {
+			d := time.Duration(st.Ms) * time.Millisecond
+			if st.Strong == 0 && st.Weak == 0 {
+				time.Sleep(d)
+				continue
+			}
+			if err := r.rumble(uint16(st.Strong*0xffff/100), uint16(st.Weak*0xffff/100), d); err != nil {
+				log.Printf("Rumble failed - %v\n", err)
+			}
+			time.Sleep(d)
+		}
+	}
+}
+
+// rumbleEvent plays the pattern for an event, unless another is playing.
+func rumbleEvent(name string) {
+	if rumbleQueue == nil {
+		return
+	}
+	select {
+	case rumbleQueue <- rumblePatterns[name]:
+	default:
+	}
+}
+
+// rumbleOnLinkLoss plays linklost each time telemetry stops arriving.
+func rumbleOnLinkLoss() {
+	lost := false
+	for {
+		now := telemetryAge() >= linkTimeout
+		if now && !lost {
+			rumbleEvent("linklost")
+		}
+		lost = now
+		time.Sleep(500 * time.Millisecond)
+	}
+}
@@ -0,0 +1,105 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// On Linux the joystick's vibration motors are driven through its evdev
+// device, found next to /dev/input/jsN in sysfs, using the kernel's force
+// feedback interface. The device must be writable, which udev usually
+// arranges for the logged in user's game controllers.
+
+// ffEffect mirrors struct ff_effect from linux/input.h for a rumble effect.
+// The kernel's union is the size of ff_periodic_effect, whose last member is
+// a pointer, hence the uintptr.
+type ffEffect struct {
+	typ             uint16
+	id              int16
+	direction       uint16
+	triggerButton   uint16
+	triggerInterval uint16
+	replayLength    uint16
+	replayDelay     uint16
+	union           [6]uint32 // strong and weak magnitude come first
+	_               uintptr
+}
+
+// inputEvent mirrors struct input_event.
+type inputEvent struct {
+	time  syscall.Timeval
+	typ   uint16
+	code  uint16
+	value int32
+}
+
+const (
+	evFF     = 0x15
+	ffRumble = 0x50
+)
+
+// eviocsff is _IOW('E', 0x80, struct ff_effect).
+var eviocsff = uintptr(1<<30 | unsafe.Sizeof(ffEffect{})<<16 | 'E'<<8 | 0x80)
+
+type evdevRumbler struct {
+	f  *os.File
+	id int16
+}
+
+func openRumble(jsID int) (rumbler, error) {
+	events, _ := filepath.Glob(fmt.Sprintf("/sys/class/input/js%d/device/event*", jsID))
+	if len(events) == 0 {
+		return nil, fmt.Errorf("no event device found for joystick %d", jsID)
+	}
+	f, err := os.OpenFile(filepath.Join("/dev/input", filepath.Base(events[0])), os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &evdevRumbler{f: f, id: -1}, nil
+}
+
+// rumble uploads the effect, reusing its slot after the first time, and plays it once.
+func (r *evdevRumbler) rumble(strong, weak uint16, d time.Duration) error {
+	effect := ffEffect{typ: ffRumble, id: r.id, replayLength: uint16(d / time.Millisecond)}
+	effect.union[0] = uint32(strong) | uint32(weak)<<16
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, r.f.Fd(), eviocsff, uintptr(unsafe.Pointer(&effect))); errno != 0 {
+		return errno
+	}
+	r.id = effect.id
+	play := inputEvent{typ: evFF, code: uint16(r.id), value: 1}
+	_, err := r.f.Write((*[unsafe.Sizeof(play)]byte)(unsafe.Pointer(&play))[:])
+	return err
+}
+
+func (r *evdevRumbler) close() {
+	r.f.Close()
+}
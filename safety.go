@@ -0,0 +1,205 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Anty0/tello"
+)
+
+// Watchers run on every flight data update and may intervene automatically,
+// each one is opt-in via its own flag.
+
+func checkSafety(fd tello.FlightData) {
+	if *dropProtectFlag {
+		drop.update(fd)
+	}
+	if *onOverheatFlag != "" {
+		heat.update(fd)
+	}
+	if *tumbleProtectFlag || *blackBoxFlag > 0 || *rumbleFlag {
+		tumble.update(fd)
+	}
+}
+
+// dropWatcher spots the drone falling faster than -droprate and briefly
+// commands full throttle to try to arrest the fall.
+type dropWatcher struct {
+	mu         sync.Mutex
+	lastHeight int16
+	lastTime   time.Time
+	recovering bool
+}
+
+var drop dropWatcher
+
+const dropSampleInterval = 100 * time.Millisecond
+
+func (w *dropWatcher) update(fd tello.FlightData) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	dt := now.Sub(w.lastTime)
+	if dt < dropSampleInterval {
+		return
+	}
+	// height is in decimetres
+	rate := float64(w.lastHeight-fd.Height) * 10 / dt.Seconds()
+	fresh := dt < 5*dropSampleInterval
+	w.lastHeight, w.lastTime = fd.Height, now
+	if !fresh || !fd.Flying || w.recovering || rate < float64(*dropRateFlag) {
+		return
+	}
+	w.recovering = true
+	log.Printf("Drop protection triggered, falling at %.0fcm/s\n", rate)
+	go w.recover()
+}
+
+func (w *dropWatcher) recover() {
+	setAlert("DROP DETECTED - CLIMBING", 3*time.Second)
+	noteWarning("drop protection triggered")
+	end := time.Now().Add(time.Duration(*dropBoostFlag) * time.Millisecond)
+	for time.Now().Before(end) {
+		sendSticks(tello.StickMessage{Ly: 32767})
+		time.Sleep(updatePeriodMs * time.Millisecond)
+	}
+	sendSticks(tello.StickMessage{})
+	w.mu.Lock()
+	w.recovering = false
+	w.mu.Unlock()
+}
+
+// heatWatcher warns while the IMU temperature is at or over -overheattemp and,
+// with -onoverheat land, lands if it stays there for -overheatgrace seconds.
+type heatWatcher struct {
+	since  time.Time // when the drone got hot, zero while it is not
+	landed bool
+}
+
+var heat heatWatcher // only used from the flight data goroutine
+
+func (w *heatWatcher) update(fd tello.FlightData) {
+	if int(fd.IMU.Temperature) < *overheatTempFlag {
+		if !w.since.IsZero() {
+			log.Printf("Drone temperature back to %dC\n", fd.IMU.Temperature)
+		}
+		w.since, w.landed = time.Time{}, false
+		return
+	}
+	now := time.Now()
+	if w.since.IsZero() {
+		w.since = now
+		log.Printf("Drone overheating at %dC\n", fd.IMU.Temperature)
+		noteWarning("drone overheated")
+	}
+	msg := fmt.Sprintf("OVERHEATING %dC", fd.IMU.Temperature)
+	if *onOverheatFlag == "land" && fd.Flying && !w.landed {
+		grace := time.Duration(*overheatGraceFlag) * time.Second
+		left := grace - now.Sub(w.since)
+		if left <= 0 {
+			log.Println("Landing, drone still overheating")
+			w.landed = true
+			go land()
+		} else {
+			msg += fmt.Sprintf(" - landing in %ds", int(left.Seconds())+1)
+		}
+	}
+	// refreshed on every update, so the banner lasts as long as the heat does
+	setAlert(msg, time.Second)
+}
+
+// tumbleWatcher spots the drone held at an extreme pitch or roll, tumbling
+// after a bad flip or grabbed by hand, and while that lasts cancels any macro
+// and holds the sticks centred so that they cannot make matters worse.
+type tumbleWatcher struct {
+	mu       sync.Mutex
+	since    time.Time // when the extreme attitude began, zero if it has not
+	tumbling bool
+	flipped  time.Time
+}
+
+var tumble tumbleWatcher
+
+const (
+	tumbleAngle = 70                     // degrees of pitch or roll
+	tumbleHold  = 300 * time.Millisecond // how long it must last
+	tumbleFlip  = 2 * time.Second        // ignored after a flip, which rolls right over
+)
+
+// noteFlip stops a deliberate flip from counting as a tumble.
+func (w *tumbleWatcher) noteFlip() {
+	w.mu.Lock()
+	w.flipped = time.Now()
+	w.mu.Unlock()
+}
+
+func (w *tumbleWatcher) update(fd tello.FlightData) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	pitch, roll, _ := tello.QuatToEulerDeg(fd.IMU.QuaternionX, fd.IMU.QuaternionY, fd.IMU.QuaternionZ, fd.IMU.QuaternionW)
+	extreme := pitch > tumbleAngle || pitch < -tumbleAngle || roll > tumbleAngle || roll < -tumbleAngle
+	if !fd.Flying || !extreme || now.Sub(w.flipped) < tumbleFlip {
+		if w.tumbling && *tumbleProtectFlag {
+			log.Println("Drone attitude back to normal")
+			setAlert("Attitude normal - sticks back", 3*time.Second)
+		}
+		w.since, w.tumbling = time.Time{}, false
+		return
+	}
+	if w.since.IsZero() {
+		w.since = now
+	}
+	if now.Sub(w.since) < tumbleHold {
+		return
+	}
+	if !w.tumbling {
+		w.tumbling = true
+		log.Printf("Tumble detected, pitch %d° roll %d°\n", pitch, roll)
+		noteWarning("tumble detected")
+		rumbleEvent("tumble")
+		// a second more shows what happened next
+		time.AfterFunc(time.Second, func() { blackBox.dump("tumble") })
+		if *tumbleProtectFlag {
+			go func() {
+				macros.cancel()
+				sendSticks(tello.StickMessage{})
+			}()
+		}
+	}
+	if !*tumbleProtectFlag {
+		return
+	}
+	setAlert(fmt.Sprintf("TUMBLING (pitch %d° roll %d°) - STICKS HELD CENTRED", pitch, roll), time.Second)
+}
+
+// active reports whether the sticks are being held centred, with -tumbleprotect.
+func (w *tumbleWatcher) active() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.tumbling && *tumbleProtectFlag
+}
@@ -0,0 +1,366 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Anty0/tello"
+)
+
+// simDrone stands in for the Tello with -simdrone. It logs every command and
+// flies a crude model of the drone from the sticks, enough to exercise the
+// joystick mappings, macros and display without hardware. There is no video.
+
+const (
+	simStep        = 50 * time.Millisecond
+	simSpeed       = 1.0  // m/s at full stick, doubled in fast mode
+	simClimb       = 1.0  // m/s at full stick
+	simTurn        = 90.0 // degrees/s at full stick
+	simTakeoffAlt  = 0.8  // metres
+	simBatteryDrop = 6.0  // seconds of flight per percent
+)
+
+type simDrone struct {
+	mu       sync.Mutex
+	fd       tello.FlightData
+	sticks   tello.StickMessage
+	fast     bool
+	climbing bool // taking off
+	landing  bool
+	x, y, z  float64 // metres north, east and up from where we started
+	yaw      float64 // degrees clockwise from the starting heading
+	battery  float64
+	homeSet  bool
+	homeX    float64
+	homeY    float64
+	target   chan bool // reports the end of AutoFlyToXY, nil if not under way
+	targetX  float64
+	targetY  float64
+	pics     int
+	started  bool
+}
+
+func newSimDrone() *simDrone {
+	s := &simDrone{battery: 100}
+	s.fd.BatteryPercentage = 100
+	s.fd.OnGround = true
+	s.fd.ImuState = true
+	s.fd.LowBatteryThreshold = 10
+	s.fd.MaxHeight = 10
+	s.fd.IMU.Temperature = 40
+	s.fd.SSID = "TELLO-SIM"
+	s.fd.Version = "sim"
+	return s
+}
+
+// cmd logs a command and shows it briefly on the status line.
+func (s *simDrone) cmd(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("SIM: %s\n", msg)
+	setAlert("SIM: "+msg, 2*time.Second)
+}
+
+func (s *simDrone) ControlConnect(udpAddr string, droneUDPPort int, localUDPPort int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log.Println("SIM: connected to simulated drone")
+	if !s.started {
+		s.started = true
+		go s.fly()
+	}
+	return nil
+}
+
+func (s *simDrone) ControlDisconnect() {
+	log.Println("SIM: disconnected")
+}
+
+func (s *simDrone) VideoConnect(udpAddr string, droneUDPPort int) (<-chan []byte, error) {
+	log.Println("SIM: video connected, no frames will arrive")
+	return make(chan []byte), nil
+}
+
+func (s *simDrone) VideoDisconnect() {}
+
+func (s *simDrone) GetFlightData() tello.FlightData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fd
+}
+
+func (s *simDrone) StreamFlightData(asAsync bool, periodMs time.Duration) (<-chan tello.FlightData, error) {
+	fdChan := make(chan tello.FlightData, 1)
+	go func() {
+		for range time.Tick(periodMs * time.Millisecond) {
+			fdChan <- s.GetFlightData()
+		}
+	}()
+	return fdChan, nil
+}
+
+func (s *simDrone) StartStickListener() (chan<- tello.StickMessage, error) {
+	sc := make(chan tello.StickMessage, 10)
+	go func() {
+		for sm := range sc {
+			s.setSticks(sm)
+		}
+	}()
+	return sc, nil
+}
+
+func (s *simDrone) setSticks(sm tello.StickMessage) {
+	s.mu.Lock()
+	s.sticks = sm
+	s.mu.Unlock()
+}
+
+func (s *simDrone) TakeOff() {
+	s.cmd("take off")
+	s.mu.Lock()
+	if !s.fd.Flying {
+		s.fd.Flying, s.fd.OnGround, s.climbing = true, false, true
+	}
+	s.mu.Unlock()
+}
+
+func (s *simDrone) ThrowTakeOff() {
+	s.cmd("throw take off")
+	s.TakeOff()
+}
+
+func (s *simDrone) Land() {
+	s.cmd("land")
+	s.mu.Lock()
+	if s.fd.Flying {
+		s.landing, s.climbing = true, false
+	}
+	s.mu.Unlock()
+}
+
+func (s *simDrone) PalmLand() {
+	s.cmd("palm land")
+	s.Land()
+}
+
+func (s *simDrone) Bounce()                 { s.cmd("bounce") }
+func (s *simDrone) Flip(dir tello.FlipType) { s.cmd("flip %d", dir) }
+
+func (s *simDrone) Hover() {
+	s.cmd("hover")
+	s.setSticks(tello.StickMessage{})
+}
+
+func (s *simDrone) SetFastMode() {
+	s.mu.Lock()
+	s.fast = true
+	s.mu.Unlock()
+}
+
+func (s *simDrone) SetSlowMode() {
+	s.mu.Lock()
+	s.fast = false
+	s.mu.Unlock()
+}
+
+// nudge sets one stick axis to pct percent, as the tello package's movement commands do.
+func (s *simDrone) nudge(axis *int16, pct int) {
+	s.mu.Lock()
+	*axis = int16(pct * math.MaxInt16 / 100)
+	s.mu.Unlock()
+}
+
+func (s *simDrone) Forward(pct int)   { s.nudge(&s.sticks.Ry, pct) }
+func (s *simDrone) Backward(pct int)  { s.nudge(&s.sticks.Ry, -pct) }
+func (s *simDrone) Left(pct int)      { s.nudge(&s.sticks.Rx, -pct) }
+func (s *simDrone) Right(pct int)     { s.nudge(&s.sticks.Rx, pct) }
+func (s *simDrone) Up(pct int)        { s.nudge(&s.sticks.Ly, pct) }
+func (s *simDrone) Down(pct int)      { s.nudge(&s.sticks.Ly, -pct) }
+func (s *simDrone) TurnLeft(pct int)  { s.nudge(&s.sticks.Lx, -pct) }
+func (s *simDrone) TurnRight(pct int) { s.nudge(&s.sticks.Lx, pct) }
+
+func (s *simDrone) StartSmartVideo(cmd tello.SVCmd) error {
+	s.cmd("smart video %d", cmd)
+	return nil
+}
+
+func (s *simDrone) SetHome() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.fd.Flying {
+		return fmt.Errorf("cannot set home position unless flying")
+	}
+	s.homeSet, s.homeX, s.homeY = true, s.x, s.y
+	log.Println("SIM: home set")
+	return nil
+}
+
+func (s *simDrone) IsHomeSet() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.homeSet
+}
+
+func (s *simDrone) AutoFlyToXY(x, y float32) (<-chan bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.homeSet {
+		return nil, fmt.Errorf("home position not set")
+	}
+	s.stopAutoFly(false)
+	s.target = make(chan bool, 1)
+	s.targetX, s.targetY = s.homeX+float64(x), s.homeY+float64(y)
+	log.Printf("SIM: auto fly to %.1f, %.1f\n", x, y)
+	return s.target, nil
+}
+
+func (s *simDrone) CancelAutoFlyToXY() {
+	s.mu.Lock()
+	s.stopAutoFly(false)
+	s.mu.Unlock()
+}
+
+// stopAutoFly ends an AutoFlyToXY, reporting whether it arrived. s.mu must be held.
+func (s *simDrone) stopAutoFly(arrived bool) {
+	if s.target == nil {
+		return
+	}
+	s.target <- arrived
+	close(s.target)
+	s.target = nil
+}
+
+func (s *simDrone) TakePicture() error {
+	s.cmd("photo")
+	s.mu.Lock()
+	s.pics++
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *simDrone) NumPics() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pics
+}
+
+func (s *simDrone) SaveAllPics(prefix string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pics > 0 {
+		log.Printf("SIM: %d simulated photo(s) not saved\n", s.pics)
+	}
+	s.pics = 0
+	return 0, nil
+}
+
+func (s *simDrone) GetLowBatteryThreshold() {}
+func (s *simDrone) GetMaxHeight()           {}
+func (s *simDrone) GetSSID()                {}
+func (s *simDrone) GetVersion()             {}
+func (s *simDrone) GetVideoBitrate()        {}
+func (s *simDrone) GetVideoSpsPps()         {}
+
+func (s *simDrone) SetVideoBitrate(vbr tello.VBR) {
+	s.mu.Lock()
+	s.fd.VideoBitrate = vbr
+	s.mu.Unlock()
+}
+
+func (s *simDrone) SetVideoNormal() { log.Println("SIM: normal video") }
+func (s *simDrone) SetVideoWide()   { log.Println("SIM: wide video") }
+
+// fly moves the model on every step and keeps the flight data up to date.
+func (s *simDrone) fly() {
+	dt := simStep.Seconds()
+	for range time.Tick(simStep) {
+		s.mu.Lock()
+		s.step(dt)
+		s.mu.Unlock()
+	}
+}
+
+// step advances the model by dt seconds. s.mu must be held.
+func (s *simDrone) step(dt float64) {
+	var north, east, up float64
+	if s.fd.Flying {
+		speed := simSpeed
+		if s.fast {
+			speed *= 2
+		}
+		fwd := float64(s.sticks.Ry) / math.MaxInt16 * speed
+		right := float64(s.sticks.Rx) / math.MaxInt16 * speed
+		up = float64(s.sticks.Ly) / math.MaxInt16 * simClimb
+		s.yaw += float64(s.sticks.Lx) / math.MaxInt16 * simTurn * dt
+		s.yaw = math.Mod(s.yaw+540, 360) - 180
+		rad := s.yaw * math.Pi / 180
+		north = fwd*math.Cos(rad) - right*math.Sin(rad)
+		east = fwd*math.Sin(rad) + right*math.Cos(rad)
+
+		if s.target != nil {
+			dx, dy := s.targetX-s.x, s.targetY-s.y
+			dist := math.Hypot(dx, dy)
+			if dist < speed*dt {
+				s.stopAutoFly(true)
+			} else {
+				north, east = dx/dist*speed, dy/dist*speed
+			}
+		}
+		switch {
+		case s.landing:
+			up = -simClimb / 2
+		case s.climbing:
+			up = simClimb
+			if s.z >= simTakeoffAlt {
+				s.climbing = false
+			}
+		}
+		s.battery -= dt / simBatteryDrop
+	}
+	s.x += north * dt
+	s.y += east * dt
+	s.z = math.Max(0, s.z+up*dt)
+	if s.fd.Flying && s.z == 0 && !s.climbing {
+		s.fd.Flying, s.fd.OnGround, s.landing = false, true, false
+		s.stopAutoFly(false)
+		north, east, up = 0, 0, 0
+		log.Println("SIM: landed")
+	}
+
+	s.fd.Height = int16(math.Round(s.z * 10))
+	s.fd.NorthSpeed = int16(math.Round(north))
+	s.fd.EastSpeed = int16(math.Round(east))
+	s.fd.VerticalSpeed = int16(math.Round(up))
+	s.fd.GroundSpeed = int16(math.Round(math.Hypot(north, east)))
+	s.fd.MVO.PositionX, s.fd.MVO.PositionY, s.fd.MVO.PositionZ = float32(s.x), float32(s.y), float32(-s.z)
+	s.fd.MVO.VelocityX = int16(north * 100)
+	s.fd.MVO.VelocityY = int16(east * 100)
+	s.fd.MVO.VelocityZ = int16(-up * 100)
+	s.fd.IMU.Yaw = int16(math.Round(s.yaw))
+	s.fd.BatteryPercentage = int8(math.Max(0, math.Ceil(s.battery)))
+	s.fd.BatteryLow = s.fd.BatteryPercentage <= int8(s.fd.LowBatteryThreshold)
+}
@@ -0,0 +1,80 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/Anty0/tello"
+)
+
+// simFly runs the simulated drone for up to n steps, stopping early once done
+// reports true.
+func simFly(s *simDrone, n int, done func(tello.FlightData) bool) tello.FlightData {
+	for i := 0; i < n; i++ {
+		s.mu.Lock()
+		s.step(simStep.Seconds())
+		fd := s.fd
+		s.mu.Unlock()
+		if done(fd) {
+			break
+		}
+	}
+	return drone.GetFlightData()
+}
+
+func TestSimDroneControlPath(t *testing.T) {
+	s := newSimDrone()
+	saved := drone
+	drone = s
+	*simDroneFlag = true
+	defer func() {
+		drone = saved
+		*simDroneFlag = false
+	}()
+
+	if !takeOff() {
+		t.Fatal("takeOff refused")
+	}
+	fd := simFly(s, 100, func(fd tello.FlightData) bool { return !s.climbing })
+	if !fd.Flying || fd.Height < 8 {
+		t.Fatalf("after takeoff Flying = %v Height = %d, want flying at 8 or more", fd.Flying, fd.Height)
+	}
+	hover := fd.Height
+
+	sendSticks(tello.StickMessage{Ly: 32767})
+	fd = simFly(s, 10, func(tello.FlightData) bool { return false })
+	if fd.Height <= hover {
+		t.Errorf("Height = %d after climbing, want above %d", fd.Height, hover)
+	}
+	sendSticks(tello.StickMessage{})
+	if s.sticks != (tello.StickMessage{}) {
+		t.Errorf("sticks = %+v after centring, want zero", s.sticks)
+	}
+
+	land()
+	fd = simFly(s, 200, func(fd tello.FlightData) bool { return !fd.Flying })
+	if fd.Flying || !fd.OnGround || fd.Height != 0 {
+		t.Errorf("after landing Flying = %v OnGround = %v Height = %d", fd.Flying, fd.OnGround, fd.Height)
+	}
+}
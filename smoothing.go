@@ -0,0 +1,57 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import "math"
+
+// With -smoothtelemetry the jumpier readings are shown as an exponential
+// moving average. Only the display is smoothed, safety checks and logs use
+// the raw flight data.
+
+type ema struct {
+	value  float64
+	primed bool
+}
+
+// add folds v into the average and returns it, or returns v if smoothing is off.
+func (e *ema) add(v float64) float64 {
+	alpha := *smoothTelemetryFlag
+	if alpha <= 0 || alpha >= 1 {
+		return v
+	}
+	if !e.primed {
+		e.value, e.primed = v, true
+		return v
+	}
+	e.value = alpha*v + (1-alpha)*e.value
+	return e.value
+}
+
+// guarded by fieldsMu, like the fields they feed
+var heightEMA, batteryEMA, speedEMA, vertSpeedEMA ema
+
+// smoothBattery never shows more charge than the drone reports, so smoothing
+// cannot hide a falling battery.
+func smoothBattery(pct int8) int {
+	return int(math.Min(math.Round(batteryEMA.add(float64(pct))), float64(pct)))
+}
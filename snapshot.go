@@ -0,0 +1,75 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// A single H.264 packet cannot be decoded on its own, so we keep the stream
+// since the last SPS (which the drone sends ahead of each keyframe) and let
+// ffmpeg decode that to get a still of the current frame.
+
+const maxGOPBytes = 4 << 20 // give up buffering if keyframes stop arriving
+
+var gop []byte // guarded by videoMu
+
+// keepFrame adds a packet of the video stream to gop, call with videoMu held.
+func keepFrame(vbuf []byte) {
+	if isSPS(vbuf) || len(gop)+len(vbuf) > maxGOPBytes {
+		gop = gop[:0]
+	}
+	gop = append(gop, vbuf...)
+}
+
+// isSPS reports whether the packet starts with an H.264 sequence parameter set.
+func isSPS(vbuf []byte) bool {
+	return len(vbuf) > 4 && bytes.Equal(vbuf[:4], []byte{0, 0, 0, 1}) && vbuf[4]&0x1f == 7
+}
+
+// saveSnapshot writes the latest video frame as a PNG in -mediadir.
+func saveSnapshot() {
+	videoMu.Lock()
+	buf := append([]byte(nil), gop...)
+	videoMu.Unlock()
+	if len(buf) == 0 || !isSPS(buf) {
+		log.Println("No video frame to snapshot, is the video feed running?")
+		return
+	}
+	filename := filepath.Join(*mediaDirFlag, fmt.Sprintf("tello_snap_%s.png", time.Now().Format(time.RFC3339)))
+	go func() {
+		// -update 1 keeps overwriting the one file so the last frame decoded wins
+		cmd := exec.Command("ffmpeg", "-loglevel", "error", "-f", "h264", "-i", "-", "-update", "1", "-y", filename)
+		cmd.Stdin = bytes.NewReader(buf)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			log.Printf("Snapshot failed - %v %s\n", err, out)
+			return
+		}
+		log.Printf("Snapshot saved to %s\n", filename)
+	}()
+}
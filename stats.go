@@ -0,0 +1,173 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Anty0/tello"
+	termbox "github.com/nsf/termbox-go"
+)
+
+// flightStats is the envelope of the session so far.
+type flightStats struct {
+	MaxHeight    float64  `json:"max_height_m"`
+	MaxSpeed     float64  `json:"max_speed_mps"`
+	MaxDrainRate float64  `json:"max_battery_drain_pct_per_min"`
+	Flips        int      `json:"flips"`
+	FlightSecs   float64  `json:"flight_seconds"`
+	Photos       int      `json:"photos"`
+	MinBattery   int8     `json:"min_battery_pct"`
+	Warnings     []string `json:"warnings,omitempty"`
+}
+
+const drainWindow = time.Minute
+
+var (
+	statsMu    sync.Mutex
+	stats      = flightStats{MinBattery: 100}
+	drainPct   int8
+	drainSince time.Time
+	lastFDAt   time.Time
+)
+
+// updateStats folds a flight data update into the session envelope.
+func updateStats(fd tello.FlightData) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	now := time.Now()
+	var elapsed time.Duration
+	if !lastFDAt.IsZero() {
+		elapsed = now.Sub(lastFDAt)
+	}
+	stats.fold(fd, elapsed)
+	lastFDAt = now
+
+	// the battery only reports whole percentages, so measure drain over a window
+	if drainSince.IsZero() || fd.BatteryPercentage > drainPct {
+		drainPct, drainSince = fd.BatteryPercentage, now
+	} else if elapsed := now.Sub(drainSince); elapsed >= drainWindow {
+		rate := float64(drainPct-fd.BatteryPercentage) / elapsed.Minutes()
+		stats.MaxDrainRate = math.Max(stats.MaxDrainRate, rate)
+		drainPct, drainSince = fd.BatteryPercentage, now
+	}
+}
+
+// fold takes in the maxima, minimum battery and flying time from a flight
+// data update arriving elapsed after the previous one.
+func (st *flightStats) fold(fd tello.FlightData, elapsed time.Duration) {
+	st.MaxHeight = math.Max(st.MaxHeight, float64(fd.Height)/10)
+	speed := math.Sqrt(float64(fd.NorthSpeed)*float64(fd.NorthSpeed) + float64(fd.EastSpeed)*float64(fd.EastSpeed))
+	st.MaxSpeed = math.Max(st.MaxSpeed, speed)
+	if fd.BatteryPercentage < st.MinBattery {
+		st.MinBattery = fd.BatteryPercentage
+	}
+	if fd.Flying {
+		st.FlightSecs += elapsed.Seconds()
+	}
+}
+
+func countFlip() {
+	statsMu.Lock()
+	stats.Flips++
+	statsMu.Unlock()
+}
+
+func countSessionPhoto() {
+	statsMu.Lock()
+	stats.Photos++
+	statsMu.Unlock()
+}
+
+// noteWarning records a warning for the exit summary, each one only once.
+func noteWarning(msg string) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	for _, w := range stats.Warnings {
+		if w == msg {
+			return
+		}
+	}
+	stats.Warnings = append(stats.Warnings, msg)
+}
+
+func getStats() flightStats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	st := stats
+	st.Warnings = append([]string(nil), stats.Warnings...)
+	return st
+}
+
+// displayStats shows the session envelope on the bottom line.
+func displayStats() {
+	if lt, show := getLifetime(); show {
+		d := time.Duration(lt.FlightSecs) * time.Second
+		text := fmt.Sprintf("Lifetime: flights %d  flying time %d:%02d  photos %d",
+			lt.Flights, int(d.Hours()), int(d.Minutes())%60, lt.Photos)
+		tbprint(1, 23, termbox.ColorWhite, termbox.ColorDefault, padString(text, minWidth-2))
+		return
+	}
+	st := getStats()
+	text := fmt.Sprintf("Session max: height %s  speed %s  drain %.1f%%/min  flips %d",
+		formatHeight(st.MaxHeight, 1), formatSpeed(st.MaxSpeed, 1), st.MaxDrainRate, st.Flips)
+	tbprint(1, 23, termbox.ColorWhite, termbox.ColorDefault, padString(text, minWidth-2))
+}
+
+// writeStats saves the session envelope as JSON for -statsfile.
+func writeStats(filename string) error {
+	buf, err := json.MarshalIndent(getStats(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf, 0644)
+}
+
+// printSummary writes a recap of the session once the screen has been restored.
+func printSummary(w io.Writer) {
+	if !telemetryStarted() {
+		return
+	}
+	st := getStats()
+	d := time.Duration(st.FlightSecs) * time.Second
+	fmt.Fprintf(w, "Flight summary\n")
+	fmt.Fprintf(w, "  flying time  %d:%02d\n", int(d.Minutes()), int(d.Seconds())%60)
+	fmt.Fprintf(w, "  max height   %s\n", formatHeight(st.MaxHeight, 1))
+	fmt.Fprintf(w, "  photos       %d\n", st.Photos)
+	fmt.Fprintf(w, "  flips        %d\n", st.Flips)
+	fmt.Fprintf(w, "  min battery  %d%%\n", st.MinBattery)
+	if len(st.Warnings) == 0 {
+		fmt.Fprintf(w, "  warnings     none\n")
+		return
+	}
+	fmt.Fprintf(w, "  warnings     %s\n", st.Warnings[0])
+	for _, warning := range st.Warnings[1:] {
+		fmt.Fprintf(w, "               %s\n", warning)
+	}
+}
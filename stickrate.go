@@ -0,0 +1,65 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"time"
+
+	"github.com/Anty0/tello"
+)
+
+// With -dronerate the joystick no longer writes straight to the drone's stick
+// listener. Producers send to a pump which keeps only the latest position and
+// forwards it to the drone on its own ticker, so the radio traffic does not
+// depend on how fast the joystick is polled.
+
+// startStickPump returns a channel for producers to send stick positions to,
+// which are passed on to out rate times a second.
+func startStickPump(out chan<- tello.StickMessage, rate int) chan<- tello.StickMessage {
+	in := make(chan tello.StickMessage)
+	go func() {
+		ticker := time.NewTicker(time.Second / time.Duration(rate))
+		defer ticker.Stop()
+		var latest tello.StickMessage
+		for {
+			select {
+			case sm := <-in:
+				latest = sm
+			case <-ticker.C:
+				out <- latest
+			}
+		}
+	}()
+	return in
+}
+
+// keepAlive resends centred sticks whenever nothing else has been sent for
+// -keepalive ms, so that a drone left hovering for a photo does not decide the
+// controller has gone. It stays quiet while the sticks are in use.
+func keepAlive(interval time.Duration) {
+	for range time.Tick(interval / 2) {
+		if idle, ok := stickIdle(); ok && idle >= interval {
+			sendSticks(tello.StickMessage{})
+		}
+	}
+}
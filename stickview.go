@@ -0,0 +1,250 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Anty0/tello"
+	termbox "github.com/nsf/termbox-go"
+)
+
+// The stick view replaces the MVO and IMU rows with two boxes showing where
+// the sticks are, as last sent to the drone.
+const (
+	stickBoxTop    = 13
+	stickBoxHeight = 7
+	stickBoxWidth  = 21
+	leftBoxX       = 12
+	rightBoxX      = 46
+)
+
+var (
+	stickMu       sync.Mutex
+	lastStick     tello.StickMessage
+	lastStickTime time.Time
+	lastCmd       string
+	lastCmdTime   time.Time
+	showStickView bool
+	showCmdPanel  bool
+)
+
+// recordStick remembers the stick message most recently sent to the drone.
+func recordStick(sm tello.StickMessage) {
+	stickMu.Lock()
+	lastStick, lastStickTime = sm, time.Now()
+	stickMu.Unlock()
+	blackBox.add(blackBoxEntry{t: lastStickTime, sm: sm})
+}
+
+// noteCommand remembers the discrete command most recently sent to the drone.
+func noteCommand(name string) {
+	stickMu.Lock()
+	lastCmd, lastCmdTime = name, time.Now()
+	stickMu.Unlock()
+	blackBox.add(blackBoxEntry{t: lastCmdTime, cmd: name})
+}
+
+// stickIdle reports how long centred sticks have been the last thing sent.
+func stickIdle() (time.Duration, bool) {
+	stickMu.Lock()
+	defer stickMu.Unlock()
+	if lastStick != (tello.StickMessage{}) {
+		return 0, false
+	}
+	return time.Since(lastStickTime), true
+}
+
+func sentStick() tello.StickMessage {
+	stickMu.Lock()
+	defer stickMu.Unlock()
+	return lastStick
+}
+
+// inStickView reports whether a screen row is hidden by the stick view.
+func inStickView(y int) bool {
+	return showStickView && y >= stickBoxTop && y < stickBoxTop+stickBoxHeight
+}
+
+func toggleStickView() {
+	showStickView = !showStickView
+	displayStaticFields()
+	displayDataFields()
+}
+
+// The command panel, on the blank row above the MVO data, shows what was last
+// sent to the drone and how long ago, for matching up with what it did.
+const cmdPanelRow = 13
+
+func toggleCmdPanel() {
+	showCmdPanel = !showCmdPanel
+	displayStaticFields()
+	displayDataFields()
+}
+
+func displayCmdPanel() {
+	stickMu.Lock()
+	sm, smTime, cmd, cmdTime := lastStick, lastStickTime, lastCmd, lastCmdTime
+	stickMu.Unlock()
+	ago := func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return fmt.Sprintf("%.1fs ago", time.Since(t).Seconds())
+	}
+	if cmd == "" {
+		cmd = "none"
+	}
+	text := fmt.Sprintf("Sent: Lx %6d Ly %6d Rx %6d Ry %6d %-10s  Cmd: %s %s",
+		sm.Lx, sm.Ly, sm.Rx, sm.Ry, ago(smTime), cmd, ago(cmdTime))
+	tbprint(1, cmdPanelRow, termbox.ColorCyan, termbox.ColorDefault, padString(text, minWidth-2))
+}
+
+func displayStickView() {
+	sm := sentStick()
+	// the left stick drives Rx/Ry and the right stick Lx/Ly, see readJoystick
+	drawStickBox(leftBoxX, "Left", sm.Rx, sm.Ry)
+	drawStickBox(rightBoxX, "Right", sm.Lx, sm.Ly)
+}
+
+func drawStickBox(x int, title string, sx, sy int16) {
+	w, h := stickBoxWidth-2, stickBoxHeight-2
+	fg, bg := termbox.ColorWhite, termbox.ColorDefault
+	tbprint(x, stickBoxTop, fg, bg, "┌"+repeatRune('─', w)+"┐")
+	tbprint(x+2, stickBoxTop, termbox.ColorWhite|termbox.AttrBold, bg, title)
+	for row := 1; row <= h; row++ {
+		tbprint(x, stickBoxTop+row, fg, bg, "│"+repeatRune(' ', w)+"│")
+	}
+	tbprint(x, stickBoxTop+h+1, fg, bg, "└"+repeatRune('─', w)+"┘")
+	// centre cross-hair then the dot
+	termbox.SetCell(x+1+w/2, stickBoxTop+1+h/2, '+', termbox.ColorBlue, bg)
+	dx := int((int32(sx) + 32767) * int32(w-1) / 65534)
+	dy := int((32767 - int32(sy)) * int32(h-1) / 65534)
+	termbox.SetCell(x+1+dx, stickBoxTop+1+dy, '●', termbox.ColorGreen|termbox.AttrBold, bg)
+}
+
+// The dead zone view, shown by -jsdrift, zooms in on the middle of each stick's
+// travel so that resting drift can be seen against the dead zone.
+const (
+	dzBoxWidth  = 41
+	dzBoxHeight = 21
+	dzSpan      = 4 * deadZone // the box edges, further out is drawn on the edge
+)
+
+// drawDeadZoneBox draws the dead zone, dotted, and a raw stick position (y up).
+func drawDeadZoneBox(x, y int, title string, sx, sy int) {
+	w, h := dzBoxWidth-2, dzBoxHeight-2
+	fg, bg := termbox.ColorWhite, termbox.ColorDefault
+	tbprint(x, y, fg, bg, "┌"+repeatRune('─', w)+"┐")
+	tbprint(x+2, y, termbox.ColorWhite|termbox.AttrBold, bg, title)
+	for row := 1; row <= h; row++ {
+		tbprint(x, y+row, fg, bg, "│"+repeatRune(' ', w)+"│")
+		for col := 0; col < w; col++ {
+			vx := col*2*dzSpan/(w-1) - dzSpan
+			vy := dzSpan - (row-1)*2*dzSpan/(h-1)
+			if inDeadZone(vx, vy) {
+				termbox.SetCell(x+1+col, y+row, '·', termbox.ColorBlue, bg)
+			}
+		}
+	}
+	tbprint(x, y+h+1, fg, bg, "└"+repeatRune('─', w)+"┘")
+
+	clamp := func(v int) int {
+		if v > dzSpan {
+			return dzSpan
+		} else if v < -dzSpan {
+			return -dzSpan
+		}
+		return v
+	}
+	dotFg := termbox.ColorGreen
+	if !inDeadZone(sx, sy) {
+		dotFg = termbox.ColorRed
+	}
+	dx := (clamp(sx) + dzSpan) * (w - 1) / (2 * dzSpan)
+	dy := (dzSpan - clamp(sy)) * (h - 1) / (2 * dzSpan)
+	termbox.SetCell(x+1+dx, y+1+dy, '●', dotFg|termbox.AttrBold, bg)
+	tbprint(x, y+h+2, fg, bg, fmt.Sprintf("x %6d  y %6d   ", sx, sy))
+}
+
+// inDeadZone reports whether a raw stick position is ignored, per axis or
+// radially as -radialdeadzone chooses.
+func inDeadZone(sx, sy int) bool {
+	if *radialDeadzoneFlag {
+		return math.Hypot(float64(sx), float64(sy)) < deadZone
+	}
+	return intAbs(int16(sx)) < deadZone && intAbs(int16(sy)) < deadZone
+}
+
+// showDeadZone draws both sticks live against the dead zone until a key is pressed.
+func showDeadZone() {
+	if err := termbox.Init(); err != nil {
+		return
+	}
+	defer termbox.Close()
+	keyed := make(chan struct{})
+	go func() {
+		for termbox.PollEvent().Type != termbox.EventKey {
+		}
+		close(keyed)
+	}()
+	for {
+		state, err := js.Read()
+		if err != nil {
+			return
+		}
+		// the reading with up positive, as readJoystick sees it before the dead zone
+		axis := func(ax int, flip bool) int {
+			ix := jsConfig.axes[ax]
+			if ix >= len(state.AxisData) {
+				return 0
+			}
+			v := int(jsConfig.axisValue(state.AxisData[ix]))
+			if flip {
+				return -v
+			}
+			return v
+		}
+		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+		tbprint(0, 0, termbox.ColorWhite|termbox.AttrBold, termbox.ColorDefault, "Dead zone (dotted) and sticks, any key to exit")
+		drawDeadZoneBox(1, 2, "Left", axis(axLeftX, false), axis(axLeftY, true))
+		drawDeadZoneBox(dzBoxWidth+3, 2, "Right", axis(axRightX, false), axis(axRightY, true))
+		termbox.Flush()
+		select {
+		case <-keyed:
+			return
+		case <-time.After(updatePeriodMs * time.Millisecond):
+		}
+	}
+}
+
+func repeatRune(r rune, n int) string {
+	rs := make([]rune, n)
+	for i := range rs {
+		rs[i] = r
+	}
+	return string(rs)
+}
@@ -23,17 +23,17 @@
 package main
 
 import (
-	"encoding/csv"
+	"context"
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"math"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"runtime/pprof"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -47,6 +47,10 @@ const (
 	minHeight      = 24
 	updatePeriodMs = 50
 	keyPct         = 33 // default speed setting from keyboard control
+
+	connectTimeout   = 10 * time.Second
+	localControlPort = 8800 // our end of the control connection
+	droneVideoPort   = 6038 // the drone's end of the video connection
 )
 
 type label struct {
@@ -111,18 +115,20 @@ const (
 	fHome
 	fSSID
 	fVersion
+	fVideoBitrate
 	fNumFields
 )
 
 var fieldsMu sync.RWMutex
 var fields [fNumFields]field
+var lastFDTime time.Time // when flight data last arrived, guarded by fieldsMu
 
 func setupFields() {
-	fields[fHeight] = field{label{8, 2, termbox.ColorWhite, termbox.ColorDefault, "Height:"}, 16, 2, 5, termbox.ColorWhite, termbox.ColorDefault, "?m"}
+	fields[fHeight] = field{label{8, 2, termbox.ColorWhite, termbox.ColorDefault, "Height:"}, 16, 2, 7, termbox.ColorWhite, termbox.ColorDefault, "?m"}
 	fields[fBattery] = field{label{34, 2, termbox.ColorWhite, termbox.ColorDefault, "Battery:"}, 43, 2, 4, termbox.ColorWhite, termbox.ColorDefault, "?%"}
 	fields[fWifiStrength] = field{label{61, 2, termbox.ColorWhite, termbox.ColorDefault, "WiFi:"}, 67, 2, 4, termbox.ColorWhite, termbox.ColorDefault, "?%"}
 
-	fields[fMaxHeight] = field{label{4, 3, termbox.ColorWhite, termbox.ColorDefault, "Max Height:"}, 16, 3, 5, termbox.ColorWhite, termbox.ColorDefault, "?m"}
+	fields[fMaxHeight] = field{label{4, 3, termbox.ColorWhite, termbox.ColorDefault, "Max Height:"}, 16, 3, 7, termbox.ColorWhite, termbox.ColorDefault, "?m"}
 	fields[fDroneBattLeft] = field{label{34, 3, termbox.ColorWhite, termbox.ColorDefault, "Voltage:"}, 43, 3, 6, termbox.ColorWhite, termbox.ColorDefault, "?"}
 	fields[fWifiInterference] = field{label{53, 3, termbox.ColorWhite, termbox.ColorDefault, "Interference:"}, 67, 3, 4, termbox.ColorWhite, termbox.ColorDefault, "?%"}
 
@@ -131,9 +137,9 @@ func setupFields() {
 	fields[fDerivedSpeed] = field{label{28, 6, termbox.ColorYellow, termbox.ColorDefault, "Derived Speed:"}, 43, 6, 7, termbox.ColorWhite, termbox.ColorDefault, "?m/s"}
 	fields[fVertSpeed] = field{label{51, 6, termbox.ColorWhite, termbox.ColorDefault, "Vertical Speed:"}, 67, 6, 7, termbox.ColorWhite, termbox.ColorDefault, "?m/s"}
 
-	fields[fGroundSpeed] = field{label{2, 7, termbox.ColorWhite, termbox.ColorDefault, "Ground Speed:"}, 16, 7, 5, termbox.ColorWhite, termbox.ColorDefault, "?m/s"}
-	fields[fFwdSpeed] = field{label{28, 7, termbox.ColorWhite, termbox.ColorDefault, "Forward Speed:"}, 43, 7, 5, termbox.ColorWhite, termbox.ColorDefault, "?m/s"}
-	fields[fLatSpeed] = field{label{52, 7, termbox.ColorWhite, termbox.ColorDefault, "Lateral Speed:"}, 67, 7, 5, termbox.ColorWhite, termbox.ColorDefault, "?m/s"}
+	fields[fGroundSpeed] = field{label{2, 7, termbox.ColorWhite, termbox.ColorDefault, "Ground Speed:"}, 16, 7, 7, termbox.ColorWhite, termbox.ColorDefault, "?m/s"}
+	fields[fFwdSpeed] = field{label{28, 7, termbox.ColorWhite, termbox.ColorDefault, "Forward Speed:"}, 43, 7, 7, termbox.ColorWhite, termbox.ColorDefault, "?m/s"}
+	fields[fLatSpeed] = field{label{52, 7, termbox.ColorWhite, termbox.ColorDefault, "Lateral Speed:"}, 67, 7, 7, termbox.ColorWhite, termbox.ColorDefault, "?m/s"}
 
 	fields[fBattLow] = field{label{3, 9, termbox.ColorWhite, termbox.ColorDefault, "Battery Low:"}, 16, 9, 5, termbox.ColorWhite, termbox.ColorDefault, "?"}
 	fields[fBattCrit] = field{label{25, 9, termbox.ColorWhite, termbox.ColorDefault, "Battery Critical:"}, 43, 9, 5, termbox.ColorWhite, termbox.ColorDefault, "?"}
@@ -167,6 +173,7 @@ func setupFields() {
 	fields[fQatW] = field{label{35, 19, termbox.ColorWhite, termbox.ColorDefault, "W Quat:"}, 43, 19, 6, termbox.ColorWhite, termbox.ColorDefault, "?"}
 	fields[fYaw] = field{label{62, 19, termbox.ColorYellow, termbox.ColorDefault, "Yaw:"}, 67, 19, 6, termbox.ColorWhite, termbox.ColorDefault, "?°"}
 
+	fields[fVideoBitrate] = field{label{4, 20, termbox.ColorWhite, termbox.ColorDefault, "Video Rate:"}, 16, 20, 8, termbox.ColorWhite, termbox.ColorDefault, "?"}
 	fields[fHome] = field{label{33, 20, termbox.ColorYellow, termbox.ColorDefault, "Home Pos:"}, 43, 20, 5, termbox.ColorWhite, termbox.ColorDefault, "?"}
 
 	fields[fSSID] = field{label{10, 22, termbox.ColorWhite, termbox.ColorDefault, "SSID:"}, 16, 22, 20, termbox.ColorWhite, termbox.ColorDefault, "?"}
@@ -175,32 +182,139 @@ func setupFields() {
 }
 
 var (
-	drone       tello.Tello
-	fdLogging   bool
-	fdLog       *csv.Writer
-	wideVideo   bool
-	useJoystick bool
-	stickChan   chan<- tello.StickMessage
+	drone          droneController = new(tello.Tello)
+	wideVideo      bool
+	useJoystick    bool
+	useCamJoystick bool
+	stickChan      chan<- tello.StickMessage
 )
 
 // program flags
 var (
-	cpuprofile  = flag.String("cpuprofile", "", "Write cpu profile to `file`")
-	logFileName = flag.String("logfile", "", "File for log output (replace stdout)")
-	fdLogFlag   = flag.String("fdlog", "", "Log some CSV flight data to this file")
-	joyHelpFlag = flag.Bool("joyhelp", false, "Print help for joystick control mapping and exit")
-	jsIDFlag    = flag.Int("jsid", 999, "ID number of joystick to use (see -jslist to get IDs)")
-	jsListFlag  = flag.Bool("jslist", false, "List attached joysticks")
-	jsTest      = flag.Bool("jstest", false, "Debug joystick mapping")
-	jsTypeFlag  = flag.String("jstype", "", "Type of joystick, options are DualShock4, HotasX, EightBitDoSF30Pro or SteamController")
-	keyHelpFlag = flag.Bool("keyhelp", false, "Print help for keyboard control mapping and exit")
-	x11Flag     = flag.Bool("x11", false, "Use '-vo x11' flag in case mplayer takes over entire window")
-	soundDevice = flag.String("sounddevice", "", "Sound device source (microphone) for video recording (in format for ffmpeg), example: default or hw:1 or default:CARD=U0x46d0x809")
+	axisScaleFlag         = flag.String("axisscale", "", "Multiply joystick axes by a `factor`, for controllers with a short range: one factor for all, or leftx=2,lefty=2,rightx=..,righty=..,throttle=..,yaw=..")
+	blackBoxFlag          = flag.Int("blackbox", 0, "Keep the last `seconds` of stick positions and commands sent, saved to -mediadir on a tumble or by key (0 = off)")
+	cmdIntervalFlag       = flag.Int("cmdinterval", 0, "Drop flips, bounces, mode changes and photos sent less than this many `ms` after the previous one (0 = off)")
+	coachBtnFlag          = flag.String("coachbtn", "l1", "`button` on the coach joystick that the instructor holds to take control (see -joyhelp)")
+	coachJsIDFlag         = flag.Int("coachjsid", 999, "ID number of an instructor's joystick that overrides the main one while -coachbtn is held")
+	coachJsTypeFlag       = flag.String("coachjstype", "", "Type of the coach joystick, same options as -jstype")
+	camToggleFlag         = flag.String("camtoggle", "", "Joystick `button` that switches ○ between taking photos and recording video")
+	camJsIDFlag           = flag.Int("camjsid", 999, "ID number of a second joystick used only for camera controls")
+	camJsTypeFlag         = flag.String("camjstype", "", "Type of the camera joystick, same options as -jstype")
+	centerEaseFlag        = flag.Float64("centerease", 0, "On stick release keep this `fraction` (e.g. 0.7) of the previous output each frame instead of stopping dead (0 = off)")
+	climbBtnFlag          = flag.String("climbbtn", "", "Joystick `button` that takes off and climbs to -climbheight (see -joyhelp)")
+	climbHeightFlag       = flag.Int("climbheight", 200, "Target height in `cm` for -climbbtn")
+	climbSpeedFlag        = flag.Int("climbspeed", 50, "Throttle in `percent` used by -climbbtn")
+	configFlag            = flag.String("config", "", "Configuration `file` (default config.json in the user's telloterm config directory)")
+	cpuprofile            = flag.String("cpuprofile", "", "Write cpu profile to `file`")
+	logFileName           = flag.String("logfile", "", "File for log output (replace stdout)")
+	debounceFlag          = flag.Int("debounce", 20, "Joystick buttons must be steady for this many `ms` before a press or release counts")
+	downloadOnExitFlag    = flag.Int("downloadonexit", 0, "On quitting, wait up to this many `seconds` for photos still coming from the drone before saving them (0 = save what has arrived)")
+	droneIndexFlag        = flag.Int("droneindex", -1, "Look for drones and connect to the one with this `index` in the -dronelist, instead of -droneip")
+	droneIPFlag           = flag.String("droneip", "192.168.10.1", "IP `address` of the Tello, change if it is not on its own access point")
+	droneListFlag         = flag.Bool("dronelist", false, "List the Tello EDUs answering on the local network (station mode) and exit")
+	dronePortFlag         = flag.Int("droneport", 8889, "UDP control `port` of the Tello")
+	endAxesFlag           = flag.String("endaxes", "", "Joystick `axes` that rest at an end, like a throttle lever, reading 0 there and full at the other: e.g. throttle or throttle=high (leftx, lefty, rightx, righty, throttle, yaw)")
+	eventJSONFlag         = flag.String("eventjson", "", "Write JSON events to `dest`: - for stdout, tcp://host:port, udp://host:port or a file")
+	dropProtectFlag       = flag.Bool("dropprotect", false, "EXPERIMENTAL: apply full throttle briefly if the drone drops faster than -droprate while flying")
+	dropRateFlag          = flag.Int("droprate", 150, "Fall rate in `cm/s` that triggers -dropprotect")
+	droneRateFlag         = flag.Int("dronerate", 0, "Send stick positions to the drone this many `times` a second, independent of joystick polling (0 = as read)")
+	dropBoostFlag         = flag.Int("dropboost", 500, "How many `ms` of full throttle -dropprotect applies")
+	faceFlipsFlag         = flag.Bool("faceflips", false, "Flip with R2 + face buttons, for joysticks without a D-Pad")
+	exportConfigFlag      = flag.String("exportconfig", "", "Write the whole active configuration, key bindings, profiles and every option, to `file` and exit")
+	fastExpoFlag          = flag.Float64("fastexpo", 0, "Stick expo in fast mode, 0 (linear) to 1 (cubic)")
+	fastMaxFlag           = flag.Float64("fastmax", 1, "Fraction of full stick travel available in fast mode")
+	fastYawFlag           = flag.Float64("fastyaw", 1, "Turn rate multiplier in fast mode")
+	fineMultFlag          = flag.Float64("finemult", 1.0/3, "Stick `multiplier` applied while R2 is held for fine control")
+	filterFlag            = flag.Int("filter", 1, "Average each joystick axis over this many `samples` to smooth out jitter (1 = off)")
+	fdLogBtnFlag          = flag.String("fdlogbtn", "", "Joystick `button` that starts and stops CSV flight data logging to a new file (see -joyhelp)")
+	fdLogFlag             = flag.String("fdlog", "", "Log some CSV flight data to this file")
+	joyHelpFlag           = flag.Bool("joyhelp", false, "Print help for joystick control mapping and exit")
+	figure8BtnFlag        = flag.String("figure8btn", "", "Joystick `button` that starts the figure-8 macro (see -joyhelp)")
+	figure8LoopsFlag      = flag.Int("figure8loops", 1, "How many `times` the figure-8 macro goes round")
+	figure8SecsFlag       = flag.Int("figure8secs", 10, "How many `seconds` each circle of the figure-8 takes, speed and turn rate are -orbitspeed and -orbityaw")
+	flipPhotoFlag         = flag.Int("flipphoto", 0, "Take a photo this many `ms` after each flip (0 = off)")
+	groundPhotoFlag       = flag.String("groundphoto", "allow", "Whether photos may be taken while the drone is not flying: allow or block")
+	headingBtnFlag        = flag.String("headingbtn", "", "Joystick `button` that turns to a saved heading, hold it to save one (see -joyhelp)")
+	holdActionsFlag       = flag.String("holdactions", "", "Actions for buttons held down, as `button=action,...` (see -joyhelp)")
+	holdMsFlag            = flag.Int("holdms", 500, "How many `ms` a button must be held for its -holdactions action")
+	holdRecordFlag        = flag.String("holdrecord", "", "Joystick `button` that records video while held down (see -joyhelp)")
+	importConfigFlag      = flag.String("importconfig", "", "Check an exported configuration `file` and make it the default configuration, then exit")
+	invertBtnFlag         = flag.String("invertbtn", "", "Joystick `button` that turns inverted controls on and off (see -joyhelp)")
+	jsDriftFlag           = flag.Bool("jsdrift", false, "Measure how far from centre and how noisy each joystick axis is at rest, show the sticks against the dead zone, then exit")
+	jsIDFlag              = flag.Int("jsid", 999, "ID number of joystick to use (see -jslist to get IDs)")
+	jsListFlag            = flag.Bool("jslist", false, "List attached joysticks")
+	jsTest                = flag.Bool("jstest", false, "Debug joystick mapping")
+	jsVerifyFlag          = flag.String("jsverify", "off", "Before flying, have each button pressed and stick pushed to check the -jstype mapping: off, new (controllers not yet checked) or always")
+	jsTestStepFlag        = flag.Int("jsteststep", 500, "With -jstest only print stick readings that change by at least this `amount` (of 32767) since the last one printed, 0 prints every reading")
+	jsValidate            = flag.Bool("jsvalidate", false, "Check the -jstype mapping against the joystick given by -jsid and exit")
+	jsTypeFlag            = flag.String("jstype", "", "Type of joystick, options are DualShock4, HotasX, EightBitDoSF30Pro or SteamController")
+	keyHelpFlag           = flag.Bool("keyhelp", false, "Print help for keyboard control mapping and exit")
+	keepAliveFlag         = flag.Int("keepalive", 0, "Resend centred sticks after this many `ms` without joystick input so the drone knows we are still here (0 = off, -stickdedup has its own -stickkeepalive)")
+	landOnJsLossFlag      = flag.Int("landonjsloss", 0, "Land if the joystick is lost while flying and not back within this many `seconds` (0 = off)")
+	landOnReconnectFlag   = flag.Bool("landonreconnect", false, "If the drone is lost while flying and reconnecting gives up, keep trying and land it as soon as it answers")
+	leftHandedFlag        = flag.Bool("lefthanded", false, "Swap the joystick's sticks and its left/right D-Pad flips (see -joyhelp)")
+	simDroneFlag          = flag.Bool("simdrone", false, "Fly a simulated drone that logs its commands instead of connecting to a Tello, to try out mappings and macros")
+	smoothTelemetryFlag   = flag.Float64("smoothtelemetry", 0, "Smooth the displayed height, battery and speeds with this `alpha` between 0 and 1, lower is smoother (0 = off)")
+	rumbleFlag            = flag.Bool("rumble", false, "Vibrate the joystick on a low battery, a lost drone, a flip or a tumble (Linux, patterns can be set in the configuration)")
+	startupDelayFlag      = flag.Int("startupdelay", 0, "Ignore the joystick for this many `ms` after connecting, while the video and telemetry settle")
+	statsFileFlag         = flag.String("statsfile", "", "Write the session's stats (maxima, flips, photos, flying time, warnings) to this `file` on exit as JSON")
+	stickDedupFlag        = flag.Bool("stickdedup", false, "Only send joystick positions to the drone when they change (plus keepalives)")
+	stickKeepaliveFlag    = flag.Int("stickkeepalive", 300, "Resend unchanged joystick positions after this many `ms` with -stickdedup")
+	takeoffBattFlag       = flag.Int("takeoffbatt", 10, "Refuse to take off with less than this battery `percent`")
+	tuneAxisFlag          = flag.Int("tuneaxis", -1, "Device `axis` of a spare dial that sets -tuneparam live while flying, numbered from 0")
+	tuneParamFlag         = flag.String("tuneparam", "max", "Stick `setting` the -tuneaxis dial drives: max (stick travel 10-100%), expo (0-1) or yaw (turn rate x0-2)")
+	tumbleProtectFlag     = flag.Bool("tumbleprotect", false, "Hold the sticks centred and cancel any macro while the drone is tipped past 70° (tumbling or grabbed)")
+	takeoffModeFlag       = flag.String("takeoffmode", "default", "Flight `mode` to switch to on takeoff: slow, fast or default (leave as is)")
+	throttleAxisFlag      = flag.Int("throttleaxis", -1, "Device `axis` of a throttle lever to use for up/down instead of the right stick, numbered from 0")
+	timelapseFlag         = flag.Int("timelapse", 0, "Take a photo every `seconds` while timelapse is toggled on (0 = disabled)")
+	yawAxisFlag           = flag.Int("yawaxis", -1, "Device `axis` that turns the drone instead of the right stick's X axis, such as a flight stick's twist, numbered from 0")
+	zeroYawBtnFlag        = flag.String("zeroyawbtn", "", "Joystick `button` that makes the current heading 0° (see -joyhelp)")
+	unsignedAxesFlag      = flag.Bool("unsignedaxes", false, "The joystick's axes read 0 to 65535, centred on 32768, rather than -32767 to 32767 (see -jsdrift)")
+	unitsFlag             = flag.String("units", "metric", "Units for height and speed display, metric or imperial")
+	videoBitrateFlag      = flag.String("videobitrate", "", "Ask the drone for this video `Mbps`: auto, 1, 1.5, 2, 3 or 4 (default: leave as is)")
+	videoFlipFlag         = flag.String("videoflip", "none", "Show the video `flipped`: none, horizontal (mirror), vertical or 180")
+	videoReconnectFlag    = flag.Int("videoreconnect", 0, "Reconnect the video stream when no frame arrives for this many `seconds` while the drone is connected (0 = never)")
+	videoPipeFlag         = flag.String("videopipe", "", "Also write the raw H.264 video to this `file`, usually a named pipe (mkfifo) read by OBS or ffmpeg")
+	x11Flag               = flag.Bool("x11", false, "Use '-vo x11' flag in case mplayer takes over entire window")
+	linkGraphFlag         = flag.Bool("linkgraph", false, "Graph the WiFi strength over the last minute, red where telemetry was late")
+	mediaDirFlag          = flag.String("mediadir", ".", "`Directory` to save photos and recordings in")
+	mirrorPhotosFlag      = flag.Bool("mirrorphotos", false, "Also save the current video frame as a PNG in -mediadir with each photo (needs the video feed and ffmpeg)")
+	mouseControlFlag      = flag.Bool("mousecontrol", false, "Experimental: drag with the mouse in the terminal to fly (left half pitch/roll, right half throttle/yaw)")
+	onOverheatFlag        = flag.String("onoverheat", "", "What to do when the drone overheats: warn, or land after -overheatgrace (default: nothing)")
+	orbitBtnFlag          = flag.String("orbitbtn", "", "Joystick `button` that starts the orbit macro (see -joyhelp)")
+	orbitSecsFlag         = flag.Int("orbitsecs", 20, "Duration of the orbit macro in `seconds`")
+	orbitSpeedFlag        = flag.Int("orbitspeed", 30, "Sideways speed of the orbit macro in `percent`, sets the radius with -orbityaw")
+	orbitYawFlag          = flag.Int("orbityaw", 30, "Turn rate of the orbit macro in `percent`")
+	overheatGraceFlag     = flag.Int("overheatgrace", 30, "`Seconds` the drone may stay overheated before -onoverheat land lands it")
+	overheatTempFlag      = flag.Int("overheattemp", 85, "IMU temperature in `degrees C` treated as overheating by -onoverheat")
+	padBatteryFlag        = flag.Int("padbattery", 20, "Warn when the wireless controller battery falls below this `percent` (Linux only)")
+	photoLogFlag          = flag.Bool("photolog", false, "Log the number, position, height and heading of each photo to a CSV file in -mediadir")
+	preflightFlag         = flag.Bool("preflight", false, "Refuse takeoff until battery, telemetry, IMU (with -readycheck) and (if started) video checks pass")
+	preflightBattFlag     = flag.Int("preflightbatt", 25, "Minimum battery `percent` required by -preflight")
+	radialDeadzoneFlag    = flag.Bool("radialdeadzone", false, "Apply the joystick dead zone to each stick's distance from centre instead of per axis")
+	readyCheckFlag        = flag.Bool("readycheck", true, "Refuse takeoff, saying why, while the drone reports its IMU is not ready (calibrating or not level)")
+	recordSegmentFlag     = flag.Int("recordsegment", 0, "Start a new recording file every this many `minutes`, at a keyframe (0 = one file)")
+	recordSidecarFlag     = flag.Bool("recordsidecar", false, "Write a JSON file beside each recording with its times, the drone's SSID and firmware and a summary of the flight data")
+	recordSlewFlag        = flag.Int("recordslew", 0, "While recording, take at least this many `ms` for any stick output to go from centre to full, for smoother footage (0 = off)")
+	recordFlipFlag        = flag.Bool("recordflip", false, "Apply -videoflip to recordings too")
+	rawLogFlag            = flag.String("rawlog", "", "Log every control packet to and from the drone in `file`, for bug reports (grows quickly)")
+	reconnectAttemptsFlag = flag.Int("reconnectattempts", 10, "Attempts to reconnect a lost drone or joystick before landing (0 = keep trying)")
+	reconnectDelayFlag    = flag.Int("reconnectdelay", 2, "`Seconds` between reconnection attempts")
+	safeLockFlag          = flag.Bool("safelock", false, "Disable flips, bounce and fast mode and cap stick travel (also set by a ~/.telloterm-safelock file)")
+	safeLockMaxFlag       = flag.Int("safelockmax", 50, "Maximum stick travel in `percent` while safe locked")
+	panoramaBtnFlag       = flag.String("panoramabtn", "", "Joystick `button` that starts the panorama macro (see -joyhelp)")
+	panoramaSecsFlag      = flag.Int("panoramasecs", 30, "Duration of the panorama macro in `seconds`")
+	panoramaYawFlag       = flag.Int("panoramayaw", 15, "Turn rate of the panorama macro in `percent`")
+	selfTestFlag          = flag.Bool("selftest", false, "Allow the self test flight (y key, pressed twice): take off, fly a small box, take a photo and land")
+	selfieBtnFlag         = flag.String("selfiebtn", "", "Joystick `button` that starts the selfie macro (see -joyhelp)")
+	selfieSecsFlag        = flag.Int("selfiesecs", 3, "How many `seconds` the selfie macro flies away (and back) for")
+	selfieSpeedFlag       = flag.Int("selfiespeed", 30, "Speed of the selfie macro in `percent`")
+	slowExpoFlag          = flag.Float64("slowexpo", 0, "Stick expo in slow mode, 0 (linear) to 1 (cubic)")
+	slowMaxFlag           = flag.Float64("slowmax", 1, "Fraction of full stick travel available in slow mode")
+	slowYawFlag           = flag.Float64("slowyaw", 1, "Turn rate multiplier in slow mode")
+	soundDevice           = flag.String("sounddevice", "", "Sound device source (microphone) for video recording (in format for ffmpeg), example: default or hw:1 or default:CARD=U0x46d0x809")
 )
 
-var player *exec.Cmd
-var converter *exec.Cmd
-
 func main() {
 	flag.Parse()
 	if *logFileName != "" {
@@ -214,6 +328,31 @@ func main() {
 	} else {
 		log.SetOutput(ioutil.Discard)
 	}
+	if *importConfigFlag != "" {
+		if err := importConfig(*importConfigFlag); err != nil {
+			badFlag("Cannot import configuration - %v", err)
+		}
+		fmt.Printf("Imported %s as the default configuration\n", *importConfigFlag)
+		os.Exit(0)
+	}
+	if err := loadConfig(*configFlag); err != nil {
+		badFlag("Cannot load configuration - %v", err)
+	}
+	if err := applyOptions(config.Options); err != nil {
+		badFlag("Bad options in configuration - %v", err)
+	}
+	if err := applyKeyConfig(config.Keys); err != nil {
+		badFlag("Bad key bindings in configuration - %v", err)
+	}
+	if err := checkOptions(); err != nil {
+		badFlag("%v", err)
+	}
+	if *exportConfigFlag != "" {
+		if err := exportConfig(*exportConfigFlag); err != nil {
+			badFlag("Cannot export configuration - %v", err)
+		}
+		os.Exit(0)
+	}
 	if *keyHelpFlag {
 		printKeyHelp()
 		os.Exit(0)
@@ -226,11 +365,67 @@ func main() {
 		listJoysticks()
 		os.Exit(0)
 	}
+	if *droneListFlag {
+		listDrones()
+		os.Exit(0)
+	}
+	if *droneIndexFlag >= 0 && !*simDroneFlag {
+		selectDrone(*droneIndexFlag)
+	}
 	if *jsIDFlag != 999 {
 		useJoystick = setupJoystick(*jsIDFlag)
 	}
+	if *rumbleFlag {
+		if !useJoystick {
+			badFlag("-rumble needs a joystick, please use -jsid")
+		}
+		var profile map[string][]rumbleStep
+		if p, _, ok := profileFor(js.Name()); ok {
+			profile = p.Rumble
+		}
+		if err := setupRumble(*jsIDFlag, config.Rumble, profile); err != nil {
+			badFlag("Cannot use -rumble - %v", err)
+		}
+	}
+	setupSafeLock()
+	setupBindings()
+	if *camJsIDFlag != 999 {
+		useCamJoystick = setupCameraJoystick(*camJsIDFlag)
+	}
+	if *coachJsIDFlag != 999 {
+		if !useJoystick {
+			badFlag("-coachjsid needs the student's joystick, please use -jsid")
+		}
+		useCoach = setupCoachJoystick(*coachJsIDFlag)
+	}
+	if *jsDriftFlag {
+		if !useJoystick {
+			fmt.Println("Please specify the joystick to check with -jsid and -jstype")
+			os.Exit(1)
+		}
+		measureDrift()
+		os.Exit(0)
+	}
+	if *jsValidate {
+		if !useJoystick {
+			fmt.Println("Please specify the joystick to validate with -jsid and -jstype")
+			os.Exit(1)
+		}
+		if !validateJoystick() {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 	if *jsTest {
-		readJoystick(true)
+		readJoystick(context.Background(), true)
+		// only returns if the joystick fails
+		os.Exit(1)
+	}
+	if *jsVerifyFlag != "off" {
+		if !useJoystick {
+			badFlag("-jsverify needs a joystick, please use -jsid")
+		}
+		verifyJoystick()
 	}
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
@@ -243,26 +438,35 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 	if *fdLogFlag != "" {
-		fdlogFile, err := os.Create(*fdLogFlag)
-		if err != nil {
+		if err := fdLogger.open(*fdLogFlag); err != nil {
 			log.Fatal("Cannot create Flight Log file: ", err)
 		}
-		defer fdlogFile.Close()
-		fdLog = csv.NewWriter(fdlogFile)
-		defer fdLog.Flush()
-		headers := []string{"Time", "X", "Y", "Z", "Yaw", "FDHeight"}
-		err = fdLog.Write(headers)
-		if err != nil {
-			log.Fatal("Cannot write headers to Flight Log file: ", err)
+	}
+	defer fdLogger.close()
+	defer closePhotoLog()
+
+	if *eventJSONFlag != "" {
+		if err := setupEvents(*eventJSONFlag); err != nil {
+			log.Fatalf("Cannot open event output %s: %v", *eventJSONFlag, err)
 		}
-		fdLogging = true
+		defer closeEvents()
 	}
 
+	// deferred ahead of termbox so that it prints after the screen is restored
+	summaryOut := os.Stdout
+	if *eventJSONFlag == "-" {
+		summaryOut = os.Stderr
+	}
+	defer printSummary(summaryOut)
+
 	err := termbox.Init()
 	if err != nil {
 		panic(err)
 	}
 	defer termbox.Close()
+	if *mouseControlFlag {
+		termbox.SetInputMode(termbox.InputEsc | termbox.InputMouse)
+	}
 
 	checkTermSize()
 	setupFields()
@@ -270,23 +474,72 @@ func main() {
 
 	displayDataFields() // FIXME remove: testing
 
-	err = drone.ControlConnectDefault()
+	if *simDroneFlag {
+		drone = newSimDrone()
+	}
+	setAlert(fmt.Sprintf("Connecting to Tello at %s:%d...", *droneIPFlag, *dronePortFlag), connectTimeout)
+	displayDataFields()
+	controlIP, controlPort = *droneIPFlag, *dronePortFlag
+	if *rawLogFlag != "" {
+		controlIP, controlPort, err = startRawLog(*rawLogFlag, *droneIPFlag, *dronePortFlag)
+		if err != nil {
+			termbox.Close()
+			log.Fatalf("Cannot start raw log - %v\n", err)
+		}
+		log.Printf("Raw logging to %s, this file grows quickly\n", *rawLogFlag)
+	}
+	connected := make(chan error, 1)
+	go func() {
+		connected <- drone.ControlConnect(controlIP, controlPort, localControlPort)
+	}()
+	select {
+	case err = <-connected:
+	case <-time.After(connectTimeout):
+		err = fmt.Errorf("timed out")
+	}
 	if err != nil {
-		termbox.Close()
-		log.Fatalf("Could not connect to Tello - %v", err)
+		noDroneFound(err)
 	}
 
-	// subscribe to FlightData events and ask for regular updates
-	fdChan, _ := drone.StreamFlightData(false, updatePeriodMs)
+	// subscribe to FlightData events as they arrive from the drone
+	fdChan, _ := drone.StreamFlightData(true, updatePeriodMs)
 	go func() {
-		for {
-			tmpFD := <-fdChan
+		for tmpFD := range fdChan {
 			fieldsMu.Lock()
+			lastFDTime = time.Now()
 			updateFields(tmpFD)
 			fieldsMu.Unlock()
+			checkSafety(tmpFD)
+			noteFlightData(tmpFD)
+			updateStats(tmpFD)
+			if *recordSidecarFlag {
+				noteClipData(tmpFD)
+			}
+			noteLifetime(tmpFD)
+			fdLogger.write(tmpFD)
 		}
 	}()
 
+	// the connection is over UDP so only arriving telemetry proves the drone is there
+	for start := time.Now(); !telemetryStarted(); time.Sleep(100 * time.Millisecond) {
+		if time.Since(start) > connectTimeout {
+			noDroneFound(fmt.Errorf("no data received"))
+		}
+	}
+	setAlert("", 0)
+	startupUntil = time.Now().Add(time.Duration(*startupDelayFlag) * time.Millisecond)
+
+	go watchDroneLink()
+	if *rumbleFlag {
+		go rumbleOnLinkLoss()
+	}
+	if *linkGraphFlag {
+		go sampleLink()
+	}
+	if useJoystick {
+		go watchPadBattery()
+	}
+
 	// update data field display regularly
 	go func() {
 		for {
@@ -298,112 +551,126 @@ func main() {
 	// ask for drone data not normally sent
 	drone.GetLowBatteryThreshold()
 	drone.GetMaxHeight()
-	drone.GetSSID()
-	drone.GetVersion()
+	go fetchDroneInfo()
+	if *videoBitrateFlag != "" {
+		vbr, _ := parseVBR(*videoBitrateFlag)
+		go requestBitrate(vbr)
+	} else {
+		drone.GetVideoBitrate()
+	}
 
-	if useJoystick {
+	if *videoPipeFlag != "" {
+		startVideoPipe()
+	}
+
+	ctx, stopJoystick := context.WithCancel(context.Background())
+	jsDone := make(chan struct{})
+	if useJoystick || *mouseControlFlag {
+		stickChan, _ = drone.StartStickListener()
+		if *droneRateFlag > 0 {
+			stickChan = startStickPump(stickChan, *droneRateFlag)
+		}
+		if *keepAliveFlag > 0 {
+			go keepAlive(time.Duration(*keepAliveFlag) * time.Millisecond)
+		}
+	} else if *selfTestFlag {
+		// the self test flies with the sticks, the keyboard keeps its own commands
 		stickChan, _ = drone.StartStickListener()
-		go readJoystick(false)
+	}
+	if useJoystick {
+		go func() {
+			readJoystick(ctx, false)
+			close(jsDone)
+		}()
+	} else {
+		close(jsDone)
+	}
+	if useCamJoystick {
+		go readCameraJoystick()
+	}
+	if useCoach {
+		go readCoachJoystick()
 	}
 
 mainloop:
 	for {
 		switch ev := termbox.PollEvent(); ev.Type {
+		case termbox.EventMouse:
+			if *mouseControlFlag {
+				mouseStick(ev)
+			}
 		case termbox.EventKey:
 			switch ev.Key {
 			case termbox.KeyEsc:
 				break mainloop
 			case termbox.KeyCtrlL:
-				termbox.Sync()
-				displayStaticFields()
-				displayDataFields()
+				keyActions["refresh"]()
 			case termbox.KeySpace:
+				noteCommand("hover")
 				drone.Hover()
 			case termbox.KeyArrowUp:
-				drone.Forward(keyPct)
+				noteCommand("forward")
+				drone.Forward(capPct(keyPct))
 			case termbox.KeyArrowDown:
-				drone.Backward(keyPct)
+				noteCommand("backward")
+				drone.Backward(capPct(keyPct))
 			case termbox.KeyArrowLeft:
-				drone.Left(keyPct)
+				noteCommand("left")
+				drone.Left(capPct(keyPct))
 			case termbox.KeyArrowRight:
-				drone.Right(keyPct)
+				noteCommand("right")
+				drone.Right(capPct(keyPct))
 			case termbox.KeyHome:
 				if drone.IsHomeSet() {
+					noteCommand("fly home")
 					drone.AutoFlyToXY(0, 0)
 				} else {
+					noteCommand("set home")
 					drone.SetHome()
 				}
 			default:
-				switch ev.Ch {
-				case 'q':
+				action := keyBindings[ev.Ch]
+				if action == "quit" {
 					break mainloop
-				case 'r':
-					termbox.Sync()
-					displayStaticFields()
-					displayDataFields()
-				case 'b':
-					drone.Bounce()
-				case 't':
-					drone.TakeOff()
-				case 'o':
-					drone.ThrowTakeOff()
-				case 'l':
-					drone.Land()
-				case 'p':
-					drone.PalmLand()
-				case 'w':
-					drone.Up(keyPct * 2)
-				case 'a':
-					drone.TurnLeft(keyPct * 2)
-				case 's':
-					drone.Down(keyPct * 2)
-				case 'd':
-					drone.TurnRight(keyPct * 2)
-				case 'f':
-					drone.TakePicture()
-				case 'v':
-					startVideo(true, false)
-				case 'c':
-					startVideo(false, true)
-				case 'x':
-					startVideo(true, true)
-				case '0':
-					drone.StartSmartVideo(tello.Sv360)
-				case '1':
-					drone.ForwardFlip()
-				case '2':
-					drone.BackFlip()
-				case '3':
-					drone.LeftFlip()
-				case '4':
-					drone.RightFlip()
-				case '+':
-					drone.SetFastMode()
-				case '-':
-					drone.SetSlowMode()
-				case '=':
-					if wideVideo {
-						drone.SetVideoNormal()
-					} else {
-						drone.SetVideoWide()
-					}
-					wideVideo = !wideVideo
+				}
+				if f, ok := keyActions[action]; ok {
+					f()
 				}
 			}
 
 		}
 	}
 
-	if drone.NumPics() > 0 {
-		drone.SaveAllPics(fmt.Sprintf("tello_pic_%s", time.Now().Format(time.RFC3339)))
+	stopJoystick()
+	select {
+	case <-jsDone:
+	case <-time.After(time.Second):
+		log.Println("Joystick did not stop in time")
+	}
+	lapse.halt()
+	finishLifetime()
+
+	if *statsFileFlag != "" {
+		if err := writeStats(*statsFileFlag); err != nil {
+			log.Printf("Cannot write stats file - %v\n", err)
+		}
 	}
 
-	if player != nil {
-		player.Process.Signal(os.Interrupt)
+	if *downloadOnExitFlag > 0 {
+		waitForPhotos(time.Duration(*downloadOnExitFlag) * time.Second)
 	}
-	if converter != nil {
-		converter.Process.Signal(os.Interrupt)
+	if n := drone.NumPics(); n > 0 {
+		setAlert(fmt.Sprintf("Saving %d photos", n), time.Minute)
+		prefix := filepath.Join(*mediaDirFlag, fmt.Sprintf("tello_pic_%s", time.Now().Format(time.RFC3339)))
+		if n, err := drone.SaveAllPics(prefix); err != nil {
+			log.Printf("Saved %d photos, then failed - %v\n", n, err)
+		} else {
+			log.Printf("Saved %d photos to %s\n", n, *mediaDirFlag)
+		}
 	}
+
+	stopPlayer()
+	stopRecording()
 }
 
 func printKeyHelp() {
@@ -422,17 +689,53 @@ p             Palm Land
 0             360 degree smart video flight
 1|2|3|4       Flip Fwd/Back/Left/Right
 f             Take Picture (Foto)
+i             Start/Stop timelapse (with -timelapse)
+j             Show/Hide joystick position view
 q/<Escape>    Quit
 r/<Ctrl-L>	  Refresh Screen
-v             Start Video (mplayer) Window, cannot be combined with c and x
-c             Start Video converter (ffmpeg) and save output to file in current directory, cannot be combined with v and x
-x             Start combination of commands v and c, cannot be combined with v and c
+v             Start Video (mplayer) Window
+c             Start Video converter (ffmpeg) and save output to file in current directory
+x             Start combination of commands v and c
 -             Slow (normal) flight mode
 +             Fast (sports) flight mode
 =             Switch between normal and wide video mode
+g             Switch the bottom line between session and lifetime stats
+k             Show/Hide the last stick positions and command sent to the drone
+m             Switch between the telemetry dashboard and a full screen video view
+y             Self test flight, press twice (with -selftest, needs space)
+n             Zero the heading: the drone's current direction becomes 0°
+u             Save the black box of recent sticks and commands (with -blackbox)
+
+The character keys can be remapped with a "keys" object in the configuration file, e.g.
+  {"keys": {"z": "land", "l": ""}}
+Actions: quit refresh bounce takeoff throwtakeoff land palmland timelapse stickview up down
+turnleft turnright photo video record videorecord smart360 flipforward flipback flipleft
+flipright fast slow widevideo lifetime setheading toheading fdlog lastcmd selftest
+zeroyaw blackbox view
 `)
 }
 
+// noDroneFound explains the likely causes of failing to reach the drone and exits.
+func noDroneFound(err error) {
+	termbox.Close()
+	log.Printf("Could not connect to Tello at %s:%d - %v\n", *droneIPFlag, *dronePortFlag, err)
+	fmt.Fprintf(os.Stderr, `No Tello found at %s:%d (%v) - are you connected to its Wi-Fi AP?
+
+  * Is the Tello switched on and has it finished starting up (flashing orange/yellow LED)?
+  * Has this computer joined the Tello's Wi-Fi network, usually named TELLO-xxxxxx?
+  * Is another program, or another copy of telloterm, already connected to it?
+  * If you used -droneip or -droneport, are they correct for your network?
+`, *droneIPFlag, *dronePortFlag, err)
+	os.Exit(1)
+}
+
+// badFlag reports an unusable command line option and exits.
+// It writes to stderr because the log is discarded unless -logfile is given.
+func badFlag(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	os.Exit(2)
+}
+
 func tbprint(x, y int, fg, bg termbox.Attribute, msg string) {
 	for _, c := range msg {
 		termbox.SetCell(x, y, c, fg, bg)
@@ -451,27 +754,209 @@ func checkTermSize() (w, h int) {
 
 func displayStaticFields() {
 	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	if videoView {
+		termbox.Flush()
+		return
+	}
 	for _, l := range staticLabels {
+		if inStickView(l.y) {
+			continue
+		}
 		tbprint(l.x, l.y, l.fg, l.bg, l.text)
 	}
 	termbox.Flush()
 }
 
 func displayDataFields() {
+	if videoView {
+		displayTelemetryAge()
+		displayVideoViewFields()
+		displayStatusLine()
+		termbox.Flush()
+		return
+	}
 	fieldsMu.RLock()
 	for _, d := range fields {
+		if inStickView(d.y) {
+			continue
+		}
 		tbprint(d.lab.x, d.lab.y, d.lab.fg, d.lab.bg, d.lab.text)
 		tbprint(d.x, d.y, d.fg, d.bg, padString(d.value, d.w))
 	}
 	fieldsMu.RUnlock()
+	if *preflightFlag {
+		displayPreflight()
+	}
+	if showStickView {
+		displayStickView()
+	} else if showCmdPanel {
+		displayCmdPanel()
+	}
+	if *linkGraphFlag {
+		displayLinkGraph()
+	}
+	displayTelemetryAge()
+	displayStats()
+	displayStatusLine()
 	termbox.Flush()
 }
 
+var (
+	alertMu    sync.Mutex
+	alertText  string
+	alertUntil time.Time
+)
+
+// setAlert shows a warning on the status line for the given time.
+func setAlert(msg string, d time.Duration) {
+	alertMu.Lock()
+	alertText, alertUntil = msg, time.Now().Add(d)
+	alertMu.Unlock()
+}
+
+func currentAlert() string {
+	alertMu.Lock()
+	defer alertMu.Unlock()
+	if time.Now().After(alertUntil) {
+		return ""
+	}
+	return alertText
+}
+
+// displayStatusLine shows any current alert and short indicators for any special modes on line 1.
+func displayStatusLine() {
+	var items []string
+	if status := reconnecting.status(); status != "" {
+		items = append(items, status)
+	}
+	if useCoach {
+		items = append(items, coach.status())
+	}
+	if videoReconnecting() {
+		items = append(items, "VIDEO RECONNECTING")
+	}
+	if useJoystick && startingUp() {
+		items = append(items, "INITIALIZING")
+	}
+	if safeLocked {
+		items = append(items, "LOCKED")
+	}
+	if isInverted() {
+		items = append(items, "INVERTED")
+	}
+	if tune := tuneStatus(); tune != "" {
+		items = append(items, tune)
+	}
+	if fdLogger.active() {
+		items = append(items, "LOGGING")
+	}
+	if pad := padBatteryStatus(); pad != "" {
+		items = append(items, pad)
+	}
+	if *camToggleFlag != "" {
+		if cameraMode == camVideo {
+			items = append(items, "Camera: VIDEO")
+		} else {
+			items = append(items, "Camera: PHOTO")
+		}
+	}
+	if name, running := macros.running(); running {
+		items = append(items, "MACRO "+name)
+	}
+	if n := drone.NumPics(); n > 0 {
+		items = append(items, fmt.Sprintf("%d photos to save", n))
+	}
+	alert := currentAlert()
+	tbprint(0, 1, termbox.ColorRed|termbox.AttrBold, termbox.ColorDefault, alert)
+	if *timelapseFlag > 0 {
+		if active, shots := lapse.status(); active {
+			items = append(items, fmt.Sprintf("TIMELAPSE ON (%d shots)", shots))
+		} else {
+			items = append(items, fmt.Sprintf("Timelapse off (%d shots)", shots))
+		}
+	}
+	x := 0
+	if alert != "" {
+		x = len(alert) + 2
+	}
+	tbprint(x, 1, termbox.ColorYellow, termbox.ColorDefault, padString(strings.Join(items, "  "), minWidth-x))
+}
+
+// Telemetry older than these is shown in yellow, then red, ahead of the
+// reconnect logic which waits for linkTimeout.
+const (
+	telemetryLate  = 300 * time.Millisecond
+	telemetryStale = time.Second
+)
+
+// displayTelemetryAge shows how fresh the flight data is at the top left.
+func displayTelemetryAge() {
+	var (
+		text string
+		fg   = termbox.ColorGreen
+	)
+	age := telemetryAge()
+	switch {
+	case !telemetryStarted():
+		text, fg = "○ no telemetry", termbox.ColorYellow
+	case age >= telemetryStale:
+		text, fg = fmt.Sprintf("● STALE %.1fs", age.Seconds()), termbox.ColorRed|termbox.AttrBold
+	case age >= telemetryLate:
+		text, fg = fmt.Sprintf("● %dms", age.Milliseconds()), termbox.ColorYellow
+	default:
+		text = fmt.Sprintf("● %dms", age.Milliseconds())
+	}
+	tbprint(0, 0, fg, termbox.ColorDefault, padString(text, 16))
+}
+
+// startupUntil is when the joystick starts being obeyed, see -startupdelay.
+var startupUntil time.Time
+
+func startingUp() bool {
+	return time.Now().Before(startupUntil)
+}
+
+// telemetryStarted reports whether any flight data has been received yet.
+func telemetryStarted() bool {
+	fieldsMu.RLock()
+	defer fieldsMu.RUnlock()
+	return !lastFDTime.IsZero()
+}
+
+// telemetryAge returns how long ago flight data was last received.
+func telemetryAge() time.Duration {
+	fieldsMu.RLock()
+	defer fieldsMu.RUnlock()
+	return time.Since(lastFDTime)
+}
+
 func padString(unpadded string, l int) (padded string) {
 	format := "%-" + strconv.Itoa(l) + "v"
 	return fmt.Sprintf(format, unpadded)
 }
 
+const (
+	feetPerMetre = 3.28084
+	mphPerMps    = 2.23694
+)
+
+// formatHeight renders a height in metres in the units chosen with -units,
+// the metric form showing the given number of decimal places.
+func formatHeight(metres float64, decimals int) string {
+	if *unitsFlag == "imperial" {
+		return fmt.Sprintf("%.1fft", metres*feetPerMetre)
+	}
+	return fmt.Sprintf("%.*fm", decimals, metres)
+}
+
+// formatSpeed renders a speed in m/s in the units chosen with -units.
+func formatSpeed(mps float64, decimals int) string {
+	if *unitsFlag == "imperial" {
+		return fmt.Sprintf("%.1fmph", mps*mphPerMps)
+	}
+	return fmt.Sprintf("%.*fm/s", decimals, mps)
+}
+
 func boolToYN(b bool) string {
 	if b {
 		return "Y"
@@ -480,20 +965,20 @@ func boolToYN(b bool) string {
 }
 
 func updateFields(newFd tello.FlightData) {
-	fields[fHeight].value = fmt.Sprintf("%.1fm", float32(newFd.Height)/10)
-	fields[fBattery].value = fmt.Sprintf("%d%%", newFd.BatteryPercentage)
+	fields[fHeight].value = formatHeight(heightEMA.add(float64(newFd.Height)/10), 1)
+	fields[fBattery].value = fmt.Sprintf("%d%%", smoothBattery(newFd.BatteryPercentage))
 	fields[fWifiStrength].value = fmt.Sprintf("%d%%", newFd.WifiStrength)
 
-	fields[fMaxHeight].value = fmt.Sprintf("%dm", newFd.MaxHeight)
+	fields[fMaxHeight].value = formatHeight(float64(newFd.MaxHeight), 0)
 	fields[fLowBattThresh].value = fmt.Sprintf("%d%%", newFd.LowBatteryThreshold)
 	fields[fWifiInterference].value = fmt.Sprintf("%d%%", newFd.WifiInterference)
 
-	fields[fDerivedSpeed].value = fmt.Sprintf("%.1fm/s", math.Sqrt(float64(newFd.NorthSpeed*newFd.NorthSpeed)+float64(newFd.EastSpeed*newFd.EastSpeed)))
-	fields[fGroundSpeed].value = fmt.Sprintf("%dm/s", newFd.GroundSpeed)
-	fields[fFwdSpeed].value = fmt.Sprintf("%dm/s", newFd.NorthSpeed)
-	fields[fLatSpeed].value = fmt.Sprintf("%dm/s", newFd.EastSpeed)
+	fields[fDerivedSpeed].value = formatSpeed(speedEMA.add(math.Sqrt(float64(newFd.NorthSpeed*newFd.NorthSpeed)+float64(newFd.EastSpeed*newFd.EastSpeed))), 1)
+	fields[fGroundSpeed].value = formatSpeed(float64(newFd.GroundSpeed), 0)
+	fields[fFwdSpeed].value = formatSpeed(float64(newFd.NorthSpeed), 0)
+	fields[fLatSpeed].value = formatSpeed(float64(newFd.EastSpeed), 0)
 
-	fields[fVertSpeed].value = fmt.Sprintf("%dm/s", newFd.VerticalSpeed)
+	fields[fVertSpeed].value = formatSpeed(vertSpeedEMA.add(float64(newFd.VerticalSpeed)), 0)
 
 	fields[fBattLow].value = boolToYN(newFd.BatteryLow)
 	fields[fBattCrit].value = boolToYN(newFd.BatteryCritical)
@@ -530,7 +1015,7 @@ func updateFields(newFd tello.FlightData) {
 	// p, r, y := tello.QuatToEulerDeg(newFd.IMU.QuaternionX, newFd.IMU.QuaternionY, newFd.IMU.QuaternionZ, newFd.IMU.QuaternionW)
 	// fields[fRoll].value = fmt.Sprintf("%d", r)
 	// fields[fPitch].value = fmt.Sprintf("%d", p)
-	fields[fYaw].value = fmt.Sprintf("%d°", newFd.IMU.Yaw)
+	fields[fYaw].value = fmt.Sprintf("%d°", relativeYaw(newFd.IMU.Yaw))
 
 	if drone.IsHomeSet() {
 		fields[fHome].value = "Set"
@@ -538,109 +1023,12 @@ func updateFields(newFd tello.FlightData) {
 		fields[fHome].value = "Unset"
 	}
 
-	fields[fSSID].value = newFd.SSID
-	fields[fVersion].value = newFd.Version
-
-	if fdLogging {
-		logLine := []string{time.Now().Format("15:04:05.000"), fmt.Sprintf("%f", newFd.MVO.PositionX),
-			fmt.Sprintf("%f", newFd.MVO.PositionY), fmt.Sprintf("%f", newFd.MVO.PositionZ),
-			fmt.Sprintf("%d", newFd.IMU.Yaw), fmt.Sprintf("%.1f", float32(newFd.Height)/10)}
-		fdLog.Write(logLine)
-	}
-}
-
-func startPlayer() (io.WriteCloser, error) {
-	if player != nil {
-		player.Process.Signal(os.Interrupt)
-	}
-
-	// start external mplayer instance...
-	// the -vo X11 parm allows it to run nicely inside a virtual machine
-	// setting the FPS to 60 seems to produce smoother video
-	if *x11Flag {
-		player = exec.Command("mplayer", "-nosound", "-vo", "x11", "-fps", "60", "-")
+	if name, ok := vbrNames[newFd.VideoBitrate]; ok && name != "auto" {
+		fields[fVideoBitrate].value = name + "Mb/s"
 	} else {
-		player = exec.Command("mplayer", "-nosound", "-fps", "60", "-")
-	}
-
-	playerIn, err := player.StdinPipe()
-	if err != nil {
-		return playerIn, err
-	}
-	err = player.Start()
-	return playerIn, err
-}
-
-func startConverter() (io.WriteCloser, error) {
-	if converter != nil {
-		converter.Process.Signal(os.Interrupt)
-	}
-
-	// start ffmpeg converter and save output to current directory
-	videoFilename := fmt.Sprintf("./tello_vid_%s.mp4", time.Now().Format(time.RFC3339))
-	if *soundDevice != "" {
-		converter = exec.Command("ffmpeg", "-f", "pulse", "-i", *soundDevice, "-i", "-", "-r", "60", videoFilename)
-	} else {
-		converter = exec.Command("ffmpeg", "-i", "-", "-r", "60", videoFilename)
-	}
-
-	converterIn, err := converter.StdinPipe()
-	if err != nil {
-		return converterIn, err
-	}
-	err = converter.Start()
-	return converterIn, err
-}
-
-func startVideo(play bool, capture bool) {
-	videochan, err := drone.VideoConnectDefault()
-	if err != nil {
-		log.Fatalf("Tello VideoConnectDefault() failed with error %v", err)
-	}
-
-	var playerIn io.WriteCloser
-	var converterIn io.WriteCloser
-	if play {
-		playerIn, err = startPlayer()
-		if err != nil {
-			log.Fatalf("Unable to start mplayer - %v", err)
-			return
-		}
-	}
-	if capture {
-		converterIn, err = startConverter()
-		if err != nil {
-			log.Fatalf("Error writing to ffmpeg %v\n", err)
-			return
-		}
+		fields[fVideoBitrate].value = "auto"
 	}
 
-	// start video feed when drone connects
-	drone.GetVideoSpsPps()
-	go func() {
-		for {
-			drone.GetVideoSpsPps()
-			time.Sleep(500 * time.Millisecond)
-		}
-	}()
-
-	go func() {
-		for {
-			vbuf := <-videochan
-
-			if play {
-				_, err := playerIn.Write(vbuf)
-				if err != nil {
-					log.Fatalf("Error writing to mplayer %v\n", err)
-				}
-			}
-
-			if capture {
-				_, err = converterIn.Write(vbuf)
-				if err != nil {
-					log.Fatalf("Error writing to ffmpeg %v\n", err)
-				}
-			}
-		}
-	}()
+	fields[fSSID].value = newFd.SSID
+	fields[fVersion].value = newFd.Version
 }
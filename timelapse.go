@@ -0,0 +1,108 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// timelapse takes a photo every interval until stopped or the drone lands.
+type timelapse struct {
+	mu    sync.Mutex
+	stop  chan struct{}
+	done  chan struct{}
+	shots int
+}
+
+var lapse timelapse
+
+func (t *timelapse) start(interval time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stop != nil {
+		return
+	}
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	go t.run(interval, t.stop, t.done)
+}
+
+func (t *timelapse) run(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	wasFlying := drone.GetFlightData().Flying
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			flying := drone.GetFlightData().Flying
+			if wasFlying && !flying {
+				log.Println("Timelapse stopped, drone has landed")
+				go t.halt()
+				return
+			}
+			wasFlying = flying
+			if err := takePhoto(); err != nil {
+				log.Printf("Timelapse photo failed: %v\n", err)
+				continue
+			}
+			t.mu.Lock()
+			t.shots++
+			t.mu.Unlock()
+		}
+	}
+}
+
+// halt stops the timelapse, if running, and waits for its goroutine to finish.
+func (t *timelapse) halt() {
+	t.mu.Lock()
+	stop, done := t.stop, t.done
+	t.stop, t.done = nil, nil
+	t.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (t *timelapse) toggle() {
+	if *timelapseFlag <= 0 {
+		return
+	}
+	if active, _ := t.status(); active {
+		t.halt()
+		return
+	}
+	t.start(time.Duration(*timelapseFlag) * time.Second)
+}
+
+func (t *timelapse) status() (active bool, shots int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stop != nil, t.shots
+}
@@ -0,0 +1,143 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/Anty0/tello"
+)
+
+// stickTuning shapes the stick response, a separate set applies in each flight mode.
+type stickTuning struct {
+	expo     float64 // 0 is linear, 1 is fully cubic
+	yawScale float64 // multiplier for the turn axis
+	maxStick float64 // fraction of full travel the sticks can command
+}
+
+var (
+	modeMu   sync.Mutex
+	fastMode bool // tracks the last SetFastMode/SetSlowMode we sent, the drone starts in slow mode
+	inverted bool // all four stick axes reversed, for training drills
+)
+
+func setFlightMode(fast bool) {
+	modeMu.Lock()
+	fastMode = fast
+	modeMu.Unlock()
+}
+
+func isFastMode() bool {
+	modeMu.Lock()
+	defer modeMu.Unlock()
+	return fastMode
+}
+
+func toggleInverted() {
+	modeMu.Lock()
+	inverted = !inverted
+	modeMu.Unlock()
+}
+
+func isInverted() bool {
+	modeMu.Lock()
+	defer modeMu.Unlock()
+	return inverted
+}
+
+// invert reverses every axis of sm while inverted controls are on.
+func invert(sm *tello.StickMessage) {
+	if !isInverted() {
+		return
+	}
+	sm.Lx, sm.Ly, sm.Rx, sm.Ry = -sm.Lx, -sm.Ly, -sm.Rx, -sm.Ry
+}
+
+func currentTuning() stickTuning {
+	if isFastMode() {
+		return stickTuning{*fastExpoFlag, *fastYawFlag, *fastMaxFlag}
+	}
+	return stickTuning{*slowExpoFlag, *slowYawFlag, *slowMaxFlag}
+}
+
+// tuneParams are the -tuneparam choices, each setting its parameter from a
+// dial's position as a fraction from 0 at one end to 1 at the other.
+var tuneParams = map[string]func(t *stickTuning, f float64) string{
+	"max": func(t *stickTuning, f float64) string {
+		t.maxStick = 0.1 + 0.9*f
+		return fmt.Sprintf("max %.0f%%", t.maxStick*100)
+	},
+	"expo": func(t *stickTuning, f float64) string {
+		t.expo = f
+		return fmt.Sprintf("expo %.2f", t.expo)
+	},
+	"yaw": func(t *stickTuning, f float64) string {
+		t.yawScale = 2 * f
+		return fmt.Sprintf("yaw x%.2f", t.yawScale)
+	},
+}
+
+var (
+	tuneMu   sync.Mutex
+	tuneText string // what the -tuneaxis dial last set, for the status line
+)
+
+// tuned returns t with param set from a dial reading, for -tuneaxis.
+func (t stickTuning) tuned(param string, dial int16) stickTuning {
+	text := tuneParams[param](&t, (float64(dial)+32767)/65534)
+	tuneMu.Lock()
+	tuneText = text
+	tuneMu.Unlock()
+	return t
+}
+
+func tuneStatus() string {
+	tuneMu.Lock()
+	defer tuneMu.Unlock()
+	if tuneText == "" {
+		return ""
+	}
+	return "TUNE " + tuneText
+}
+
+// apply shapes each axis of sm in place.
+func (t stickTuning) apply(sm *tello.StickMessage) {
+	sm.Lx = t.shape(sm.Lx, t.yawScale)
+	sm.Ly = t.shape(sm.Ly, 1)
+	sm.Rx = t.shape(sm.Rx, 1)
+	sm.Ry = t.shape(sm.Ry, 1)
+}
+
+func (t stickTuning) shape(v int16, scale float64) int16 {
+	x := float64(v) / 32767
+	x = (1-t.expo)*x + t.expo*x*x*x
+	x *= scale * t.maxStick
+	if x > 1 {
+		x = 1
+	} else if x < -1 {
+		x = -1
+	}
+	return int16(math.Round(x * 32767))
+}
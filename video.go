@@ -0,0 +1,519 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Anty0/tello"
+)
+
+// videoRecorder pipes the raw video stream into an ffmpeg process writing an mp4 file.
+type videoRecorder struct {
+	cmd      *exec.Cmd
+	in       io.WriteCloser
+	filename string
+	started  time.Time
+}
+
+// clipData is the flight data envelope of the file being recorded, for
+// -recordsidecar. It has its own lock so that telemetry never waits on video.
+type clipData struct {
+	mu      sync.Mutex
+	active  bool
+	atStart flightStats // the session stats when the file was begun
+	stats   flightStats
+	lastFD  time.Time
+}
+
+var clip clipData
+
+// recordingSidecar describes a recording, written beside it with -recordsidecar.
+type recordingSidecar struct {
+	File      string      `json:"file"`
+	Start     time.Time   `json:"start"`
+	End       time.Time   `json:"end"`
+	Duration  float64     `json:"duration_seconds"`
+	SSID      string      `json:"drone_ssid,omitempty"`
+	Firmware  string      `json:"drone_firmware,omitempty"`
+	Telemetry flightStats `json:"telemetry"`
+}
+
+// videoMu guards the video feed state, the player and the recorder, all of which
+// may be started and stopped from the keyboard or either joystick.
+var (
+	videoMu      sync.Mutex
+	videoStarted bool
+	lastFrame    time.Time
+	player       *exec.Cmd
+	playerIn     io.WriteCloser
+	recorder     videoRecorder
+	pipeOut      io.WriteCloser
+	videoGen     int       // bumped on each reconnection so that a stale reader stops
+	videoRetry   time.Time // when the feed was last reconnected, zero once frames arrive
+)
+
+const pipeOpenTimeout = 10 * time.Second
+
+// videoFlips are the -videoflip choices as mplayer and ffmpeg video filters.
+var videoFlips = map[string]struct{ mplayer, ffmpeg string }{
+	"none":       {"", ""},
+	"horizontal": {"mirror", "hflip"},
+	"vertical":   {"flip", "vflip"},
+	"180":        {"mirror,flip", "hflip,vflip"},
+}
+
+func (r *videoRecorder) start() error {
+	// start ffmpeg converter and save output to the media directory
+	r.filename = filepath.Join(*mediaDirFlag, fmt.Sprintf("tello_vid_%s.mp4", time.Now().Format(time.RFC3339)))
+	var args []string
+	if *soundDevice != "" {
+		args = append(args, "-f", "pulse", "-i", *soundDevice)
+	}
+	args = append(args, "-i", "-", "-r", "60")
+	if vf := videoFlips[*videoFlipFlag].ffmpeg; vf != "" && *recordFlipFlag {
+		args = append(args, "-vf", vf)
+	}
+	r.cmd = exec.Command("ffmpeg", append(args, r.filename)...)
+
+	var err error
+	r.in, err = r.cmd.StdinPipe()
+	if err != nil {
+		r.in = nil
+		return err
+	}
+	if err = r.cmd.Start(); err != nil {
+		r.in = nil
+	}
+	r.started = time.Now()
+	if err == nil && *recordSidecarFlag {
+		clip.begin()
+	}
+	return err
+}
+
+func (c *clipData) begin() {
+	atStart := getStats()
+	c.mu.Lock()
+	c.active, c.atStart, c.stats, c.lastFD = true, atStart, flightStats{MinBattery: 100}, time.Time{}
+	c.mu.Unlock()
+}
+
+// end stops collecting and returns the session stats at the start of the file
+// and the envelope over it.
+func (c *clipData) end() (flightStats, flightStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active = false
+	return c.atStart, c.stats
+}
+
+// noteClipData folds flight data into the envelope of the file being recorded.
+func noteClipData(fd tello.FlightData) {
+	clip.mu.Lock()
+	defer clip.mu.Unlock()
+	if !clip.active {
+		return
+	}
+	now := time.Now()
+	var elapsed time.Duration
+	if !clip.lastFD.IsZero() {
+		elapsed = now.Sub(clip.lastFD)
+	}
+	clip.stats.fold(fd, elapsed)
+	clip.lastFD = now
+}
+
+// writeSidecar saves the description of the recording filename, begun at
+// started, as JSON beside it, with the flips, photos and warnings of the
+// session while it was recorded.
+func writeSidecar(filename string, started time.Time, atStart, stats flightStats) {
+	end := time.Now()
+	st := getStats()
+	stats.Flips, stats.Photos = st.Flips-atStart.Flips, st.Photos-atStart.Photos
+	stats.Warnings = st.Warnings[len(atStart.Warnings):]
+	di, _ := getDroneInfo()
+	buf, err := json.MarshalIndent(recordingSidecar{
+		File: filepath.Base(filename), Start: started, End: end, Duration: end.Sub(started).Seconds(),
+		SSID: di.SSID, Firmware: di.Version, Telemetry: stats,
+	}, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(strings.TrimSuffix(filename, ".mp4")+".json", buf, 0644)
+	}
+	if err != nil {
+		log.Printf("Cannot write recording sidecar - %v\n", err)
+	}
+}
+
+// writer returns ffmpeg's input for a video packet, nil if not recording,
+// call with videoMu held. With -recordsegment a new file is begun once the
+// segment is long enough, at the next keyframe (which the drone sends with its
+// SPS) so that every file plays on its own.
+func (r *videoRecorder) writer(vbuf []byte) io.WriteCloser {
+	if !r.running() {
+		return nil
+	}
+	if *recordSegmentFlag > 0 && isSPS(vbuf) && time.Since(r.started) >= time.Duration(*recordSegmentFlag)*time.Minute {
+		r.stop()
+		if err := r.start(); err != nil {
+			log.Printf("Unable to start ffmpeg for the next segment - %v\n", err)
+			return nil
+		}
+		log.Printf("Recording continues in %s\n", r.filename)
+	}
+	return r.in
+}
+
+// stop closes ffmpeg's input so that it can finish writing the file in its own time.
+func (r *videoRecorder) stop() {
+	if r.in == nil {
+		return
+	}
+	r.in.Close()
+	go r.cmd.Wait()
+	r.in = nil
+	if *recordSidecarFlag {
+		atStart, stats := clip.end()
+		go writeSidecar(r.filename, r.started, atStart, stats)
+	}
+}
+
+func (r *videoRecorder) running() bool {
+	return r.in != nil
+}
+
+// startVideoFeed connects to the Tello video stream, once, and copies every frame
+// to the player and recorder if they are running.
+func startVideoFeed() error {
+	videoMu.Lock()
+	defer videoMu.Unlock()
+	if videoStarted {
+		return nil
+	}
+	videochan, err := drone.VideoConnect(*droneIPFlag, droneVideoPort)
+	if err != nil {
+		return err
+	}
+	videoStarted = true
+
+	// start video feed when drone connects
+	drone.GetVideoSpsPps()
+	go func() {
+		for {
+			drone.GetVideoSpsPps()
+			time.Sleep(500 * time.Millisecond)
+		}
+	}()
+
+	go readVideo(videochan, videoGen)
+	if *videoReconnectFlag > 0 {
+		go watchVideoFeed()
+	}
+	return nil
+}
+
+// readVideo copies every frame to the player, pipe and recorder if they are
+// running, until the feed is reconnected. The writes are made without
+// videoMu held, so that a pipe reader or ffmpeg falling behind holds up only
+// the video and not everything else that looks at it.
+func readVideo(videochan <-chan []byte, gen int) {
+	for vbuf := range videochan {
+		videoMu.Lock()
+		if gen != videoGen {
+			videoMu.Unlock()
+			return
+		}
+		if !videoRetry.IsZero() {
+			log.Println("Video feed back")
+			videoRetry = time.Time{}
+		}
+		lastFrame = time.Now()
+		if *mirrorPhotosFlag {
+			keepFrame(vbuf)
+		}
+		play, pipe, rec := playerIn, pipeOut, recorder.writer(vbuf)
+		videoMu.Unlock()
+
+		// a handle replaced or closed meanwhile is not an error worth reporting
+		if play != nil {
+			if _, err := play.Write(vbuf); err != nil {
+				videoMu.Lock()
+				if playerIn == play {
+					log.Printf("Error writing to mplayer %v\n", err)
+					stopPlayerLocked()
+				}
+				videoMu.Unlock()
+			}
+		}
+		if pipe != nil {
+			if _, err := pipe.Write(vbuf); err != nil {
+				videoMu.Lock()
+				if pipeOut == pipe {
+					log.Printf("Error writing to video pipe %v, waiting for a new reader\n", err)
+					pipeOut.Close()
+					pipeOut = nil
+					go openVideoPipe(*videoPipeFlag)
+				}
+				videoMu.Unlock()
+			}
+		}
+		if rec != nil {
+			if _, err := rec.Write(vbuf); err != nil {
+				videoMu.Lock()
+				if recorder.in == rec {
+					log.Printf("Error writing to ffmpeg %v\n", err)
+					recorder.stop()
+				}
+				videoMu.Unlock()
+			}
+		}
+	}
+}
+
+// watchVideoFeed reconnects the video stream when no frame has arrived for
+// -videoreconnect seconds while the drone itself is still talking to us, and
+// restarts the player, which may not recover by itself.
+func watchVideoFeed() {
+	stall := time.Duration(*videoReconnectFlag) * time.Second
+	for {
+		time.Sleep(time.Second)
+		videoMu.Lock()
+		stalled := !lastFrame.IsZero() && time.Since(lastFrame) >= stall && time.Since(videoRetry) >= stall
+		videoMu.Unlock()
+		if !stalled || telemetryAge() >= linkTimeout {
+			continue
+		}
+		log.Println("Video feed stalled, reconnecting")
+		videoMu.Lock()
+		videoRetry = time.Now()
+		drone.VideoDisconnect()
+		videochan, err := drone.VideoConnect(*droneIPFlag, droneVideoPort)
+		if err == nil {
+			videoGen++
+			go readVideo(videochan, videoGen)
+		}
+		playing := playerIn != nil
+		videoMu.Unlock()
+		if err != nil {
+			log.Printf("Video reconnect failed - %v\n", err)
+			continue
+		}
+		drone.GetVideoSpsPps()
+		if playing {
+			if err := startPlayer(); err != nil {
+				log.Printf("Unable to restart mplayer - %v\n", err)
+			}
+		}
+	}
+}
+
+// videoReconnecting reports whether the video feed has been reconnected and no frame has arrived since.
+func videoReconnecting() bool {
+	videoMu.Lock()
+	defer videoMu.Unlock()
+	return !videoRetry.IsZero()
+}
+
+// videoFrameAge returns how long ago a video frame arrived and whether the feed was started at all.
+func videoFrameAge() (time.Duration, bool) {
+	videoMu.Lock()
+	defer videoMu.Unlock()
+	return time.Since(lastFrame), videoStarted
+}
+
+// startVideoPipe sends the raw H.264 stream to the -videopipe file, normally a
+// named pipe read by OBS or ffmpeg.
+func startVideoPipe() {
+	if err := startVideoFeed(); err != nil {
+		log.Printf("Tello VideoConnect() failed with error %v\n", err)
+		return
+	}
+	go openVideoPipe(*videoPipeFlag)
+}
+
+// openVideoPipe waits for a reader to open the pipe, warning if none appears in time.
+func openVideoPipe(path string) {
+	opened := make(chan io.WriteCloser)
+	go func() {
+		// opening a named pipe for writing blocks until there is a reader
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			log.Printf("Cannot open video pipe %s - %v\n", path, err)
+			setAlert("Cannot open video pipe", 10*time.Second)
+			close(opened)
+			return
+		}
+		opened <- f
+	}()
+
+	var f io.WriteCloser
+	select {
+	case f = <-opened:
+	case <-time.After(pipeOpenTimeout):
+		log.Printf("No reader on video pipe %s yet, still waiting\n", path)
+		setAlert("Waiting for a reader on the video pipe", pipeOpenTimeout)
+		f = <-opened
+	}
+	if f == nil {
+		return
+	}
+	videoMu.Lock()
+	pipeOut = f
+	videoMu.Unlock()
+	log.Printf("Video pipe %s connected\n", path)
+}
+
+func startPlayer() error {
+	videoMu.Lock()
+	defer videoMu.Unlock()
+	stopPlayerLocked()
+
+	// start external mplayer instance...
+	// the -vo X11 parm allows it to run nicely inside a virtual machine
+	// setting the FPS to 60 seems to produce smoother video
+	args := []string{"-nosound"}
+	if *x11Flag {
+		args = append(args, "-vo", "x11")
+	}
+	if vf := videoFlips[*videoFlipFlag].mplayer; vf != "" {
+		args = append(args, "-vf", vf)
+	}
+	if videoView {
+		args = append(args, "-fs")
+	}
+	player = exec.Command("mplayer", append(args, "-fps", "60", "-")...)
+
+	in, err := player.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err = player.Start(); err != nil {
+		return err
+	}
+	playerIn = in
+	return nil
+}
+
+func stopPlayer() {
+	videoMu.Lock()
+	stopPlayerLocked()
+	videoMu.Unlock()
+}
+
+func stopPlayerLocked() {
+	if playerIn == nil {
+		return
+	}
+	playerIn.Close()
+	player.Process.Signal(os.Interrupt)
+	go player.Wait()
+	playerIn = nil
+}
+
+func isPlaying() bool {
+	videoMu.Lock()
+	defer videoMu.Unlock()
+	return playerIn != nil
+}
+
+// startRecording (re)starts the ffmpeg recorder on a new file.
+func startRecording() error {
+	if err := startVideoFeed(); err != nil {
+		return err
+	}
+	videoMu.Lock()
+	defer videoMu.Unlock()
+	recorder.stop()
+	return recorder.start()
+}
+
+func stopRecording() {
+	videoMu.Lock()
+	recorder.stop()
+	videoMu.Unlock()
+}
+
+func isRecording() bool {
+	videoMu.Lock()
+	defer videoMu.Unlock()
+	return recorder.running()
+}
+
+func toggleRecording() {
+	if isRecording() {
+		stopRecording()
+		return
+	}
+	if err := startRecording(); err != nil {
+		log.Printf("Unable to start ffmpeg - %v\n", err)
+	}
+}
+
+func togglePlayer() {
+	if isPlaying() {
+		stopPlayer()
+		return
+	}
+	if err := startVideoFeed(); err != nil {
+		log.Printf("Tello VideoConnect() failed with error %v\n", err)
+		return
+	}
+	if err := startPlayer(); err != nil {
+		log.Printf("Unable to start mplayer - %v\n", err)
+	}
+}
+
+func setWideVideo(wide bool) {
+	if wide {
+		drone.SetVideoWide()
+	} else {
+		drone.SetVideoNormal()
+	}
+	wideVideo = wide
+}
+
+func startVideo(play bool, capture bool) {
+	if err := startVideoFeed(); err != nil {
+		log.Fatalf("Tello VideoConnect() failed with error %v", err)
+	}
+	if play {
+		if err := startPlayer(); err != nil {
+			log.Fatalf("Unable to start mplayer - %v", err)
+		}
+	}
+	if capture {
+		if err := startRecording(); err != nil {
+			log.Fatalf("Unable to start ffmpeg - %v", err)
+		}
+	}
+}
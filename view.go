@@ -0,0 +1,74 @@
+// MIT License
+
+// Copyright (c) 2018 Stephen Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	termbox "github.com/nsf/termbox-go"
+)
+
+// In the video view the terminal shows only the status line and a single row
+// of the key flight data, so it can be shrunk beside a full screen video
+// window. The dashboard, the normal view, shows all the telemetry and no video.
+// Flying is unaffected either way.
+
+var videoView bool
+
+// videoViewFields are the flight data shown in the video view, with shorter labels.
+var videoViewFields = []struct {
+	f    int
+	text string
+}{
+	{fBattery, "Batt"}, {fHeight, "Ht"}, {fGroundSpeed, "Spd"}, {fVertSpeed, "VSpd"},
+	{fYaw, "Yaw"}, {fWifiStrength, "WiFi"}, {fFlyMode, "Mode"},
+}
+
+func toggleView() {
+	videoView = !videoView
+	if videoView {
+		stopPlayer()
+		if err := startVideoFeed(); err != nil {
+			log.Printf("Tello VideoConnect() failed with error %v\n", err)
+		} else if err := startPlayer(); err != nil {
+			log.Printf("Unable to start mplayer - %v\n", err)
+		}
+	} else {
+		stopPlayer()
+	}
+	displayStaticFields()
+	displayDataFields()
+}
+
+// displayVideoViewFields shows the video view's flight data on row 2.
+func displayVideoViewFields() {
+	fieldsMu.RLock()
+	items := make([]string, len(videoViewFields))
+	for i, vf := range videoViewFields {
+		items[i] = fmt.Sprintf("%s %s", vf.text, fields[vf.f].value)
+	}
+	fieldsMu.RUnlock()
+	tbprint(0, 2, termbox.ColorWhite, termbox.ColorDefault, padString(strings.Join(items, "  "), minWidth))
+}